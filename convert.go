@@ -0,0 +1,236 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/fs2/bptree"
+	"github.com/timtadh/fs2/fmap"
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/graple/graph"
+)
+
+// attrFilter keeps the vertices whose attribute matches a pattern (see
+// graph.LabelFilter).
+type attrFilter struct {
+	attr   string
+	filter *graph.LabelFilter
+}
+
+func ParseAttrFilter(str string) attrFilter {
+	i := strings.Index(str, "=")
+	if i <= 0 {
+		fmt.Fprintf(os.Stderr, "Expected --where=<attr>=<pattern> got %q\n", str)
+		Usage(ErrorCodes["opts"])
+	}
+	return attrFilter{str[:i], AddLabelFilter(nil, str[i+1:])}
+}
+
+func (f attrFilter) Match(obj graph.JsonObject) bool {
+	a, has := obj[f.attr]
+	return has && f.filter.Match(fmt.Sprint(a))
+}
+
+func ConvertUsage() {
+	fmt.Fprintln(os.Stderr, "usage: graple convert [-o <path>] [--output-format=<format>] [Options]* <input-path>...")
+	Usage(ErrorCodes["opts"])
+}
+
+// ConvertMain is the convert subcommand. It loads the input, keeps the
+// part of it selected by the filters and writes it in another format.
+func ConvertMain(argv []string) {
+	args, optargs, err := getopt.GetOpt(
+		argv,
+		"ho:",
+		append([]string{
+			"help",
+			"output=",
+			"output-format=",
+			"keep-vertex-labels=",
+			"where=",
+			"component=",
+		}, LoadLongOpts...),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		ConvertUsage()
+	}
+	output := ""
+	format := ""
+	component := -1
+	var keepLabels *graph.LabelFilter
+	var where []attrFilter
+	opts := NewLoadOptions()
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			Usage(0)
+		case "-o", "--output":
+			output = oa.Arg()
+		case "--output-format":
+			format = oa.Arg()
+		case "--keep-vertex-labels":
+			keepLabels = AddLabelFilter(keepLabels, oa.Arg())
+		case "--where":
+			where = append(where, ParseAttrFilter(oa.Arg()))
+		case "--component":
+			component = ParseInt(oa.Arg())
+		default:
+			opts.Option(oa)
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+		ConvertUsage()
+	}
+	if opts.MultiLabels {
+		fmt.Fprintln(os.Stderr, "convert does not support --multi-labels")
+		ConvertUsage()
+	}
+	if format == "" {
+		format = "veg"
+		ext := path.Ext(strings.TrimSuffix(output, ".gz"))
+		for _, f := range graph.ExportFormats {
+			if ext == "."+f {
+				format = f
+			}
+		}
+	}
+	known := false
+	for _, f := range graph.ExportFormats {
+		known = known || f == format
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "Unknown output format %q expected one of %v\n", format, strings.Join(graph.ExportFormats, ", "))
+		ConvertUsage()
+	}
+
+	nodeBf, err := fmap.Anonymous(fmap.BLOCKSIZE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer nodeBf.Close()
+	nodeAttrs, err := bptree.New(nodeBf, 4, -1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	edgeBf, err := fmap.Anonymous(fmap.BLOCKSIZE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer edgeBf.Close()
+	edgeAttrs, err := bptree.New(edgeBf, 4, -1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	input := opts.Load(args, nodeAttrs, edgeAttrs)
+	G := input.G
+	vertexAttrs := func(idx int) graph.JsonObject {
+		obj, err := graph.TreeAttrs(nodeAttrs, idx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return obj
+	}
+
+	keep := make([]bool, len(G.V))
+	for i := range G.V {
+		keep[i] = true
+		if keepLabels != nil && !keepLabels.Match(G.Colors[G.V[i].Color]) {
+			keep[i] = false
+			continue
+		}
+		if len(where) > 0 {
+			attrs := vertexAttrs(i)
+			for _, f := range where {
+				if !f.Match(attrs) {
+					keep[i] = false
+					break
+				}
+			}
+		}
+	}
+	if component >= 0 {
+		components, sizes := graph.ConnectedComponents(G, keep)
+		if component >= len(sizes) {
+			log.Fatalf("There is no component %d (there are %d)", component, len(sizes))
+		}
+		for i := range keep {
+			keep[i] = components[i] == component
+		}
+	}
+
+	x := graph.NewExport(G, keep, opts.Undirected)
+	x.VertexAttrs = vertexAttrs
+	x.EdgeAttrs = func(idx int) graph.JsonObject {
+		obj, err := graph.TreeAttrs(edgeAttrs, idx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return obj
+	}
+	x.Transactions = input.Transactions
+
+	var w io.Writer = os.Stdout
+	if output != "" && output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	buf := bufio.NewWriter(w)
+	w = buf
+	var gz *gzip.Writer
+	if strings.HasSuffix(output, ".gz") {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+	if err := x.Write(w, format); err != nil {
+		log.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d vertices and %d edges as %v", len(x.Vertices), len(x.Edges), format)
+}
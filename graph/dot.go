@@ -0,0 +1,186 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+import (
+	"github.com/timtadh/goiso"
+)
+
+// UndirectedEdges is the edges of sg with each pair of opposing arcs
+// (as loaded by an Undirected Loader) collapsed into a single edge.
+func UndirectedEdges(sg *goiso.SubGraph) []goiso.Edge {
+	edges := make([]goiso.Edge, 0, len(sg.E)/2+1)
+	for _, i := range undirectedEdges(sg) {
+		edges = append(edges, sg.E[i])
+	}
+	return edges
+}
+
+// undirectedEdges is the indices in sg.E of the UndirectedEdges. A self
+// loop is loaded as a single arc so each one is kept.
+func undirectedEdges(sg *goiso.SubGraph) []int {
+	type key struct{ u, v, color int }
+	seen := make(map[key]int)
+	edges := make([]int, 0, len(sg.E)/2+1)
+	for i, e := range sg.E {
+		if e.Src == e.Targ {
+			edges = append(edges, i)
+			continue
+		}
+		k := key{e.Src, e.Targ, e.Color}
+		if e.Targ < e.Src {
+			k = key{e.Targ, e.Src, e.Color}
+		}
+		if seen[k]%2 == 0 {
+			edges = append(edges, i)
+		}
+		seen[k]++
+	}
+	return edges
+}
+
+func allEdges(sg *goiso.SubGraph, undirected bool) []int {
+	if undirected {
+		return undirectedEdges(sg)
+	}
+	edges := make([]int, len(sg.E))
+	for i := range edges {
+		edges[i] = i
+	}
+	return edges
+}
+
+// GraphEdges is the edges of g the edges of sg (a subgraph of g) embed
+// into, indexed like sg.E. An edge is nil if there is no such edge. The
+// embedding does not say which of several parallel edges (with the same
+// endpoints and label) an edge is so each is matched to a distinct one in
+// the order they are in g.
+func GraphEdges(g *goiso.Graph, sg *goiso.SubGraph) []*goiso.Edge {
+	edges := make([]*goiso.Edge, len(sg.E))
+	matched := make(map[int]bool, len(sg.E))
+	for i := range sg.E {
+		e := &sg.E[i]
+		src := sg.V[e.Src].Id
+		targ := sg.V[e.Targ].Id
+		for _, k := range g.Kids[src] {
+			if k.Targ == targ && k.Color == e.Color && !matched[k.Idx] {
+				matched[k.Idx] = true
+				edges[i] = k
+				break
+			}
+		}
+	}
+	return edges
+}
+
+func dotAttrs(attrs map[string]interface{}, skip ...string) string {
+	keys := make([]string, 0, len(attrs))
+outer:
+	for k := range attrs {
+		for _, s := range skip {
+			if k == s {
+				continue outer
+			}
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, ",%s=%s", strconv.Quote(k), strconv.Quote(fmt.Sprint(attrs[k])))
+	}
+	return buf.String()
+}
+
+// Dot renders sg (a subgraph of g) in the DOT language. attrs are the
+// vertex attributes keyed by the vertex index in g and edgeAttrs are the
+// edge attributes keyed by the edge index in sg. Either may be nil. If
+// undirected each pair of opposing arcs is drawn as a single "--" edge.
+func Dot(g *goiso.Graph, sg *goiso.SubGraph, attrs, edgeAttrs map[int]map[string]interface{}, undirected bool) string {
+	kind, arrow := "digraph", "->"
+	if undirected {
+		kind, arrow = "graph", "--"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s {\n", kind)
+	for i, v := range sg.V {
+		fmt.Fprintf(&buf, "    n%d [label=%s%s];\n", i, strconv.Quote(g.Colors[v.Color]), dotAttrs(attrs[v.Id], "label"))
+	}
+	for _, i := range allEdges(sg, undirected) {
+		e := &sg.E[i]
+		fmt.Fprintf(&buf, "    n%d %s n%d [label=%s%s];\n", e.Src, arrow, e.Targ, strconv.Quote(g.Colors[e.Color]), dotAttrs(edgeAttrs[i], "src", "targ", "label"))
+	}
+	fmt.Fprintln(&buf, "}")
+	return buf.String()
+}
+
+// OriginalIdAttr is the attribute VEG keeps the id a vertex was loaded
+// with in (the vertices of the rendered subgraph are renumbered).
+const OriginalIdAttr = "original_id"
+
+// VEG renders sg (a subgraph of g) as veg. The vertices are numbered by
+// their index in sg. attrs and edgeAttrs are as for Dot. If undirected
+// there is one edge line for each pair of opposing arcs.
+func VEG(g *goiso.Graph, sg *goiso.SubGraph, attrs, edgeAttrs map[int]map[string]interface{}, undirected bool) []byte {
+	var buf bytes.Buffer
+	for i, v := range sg.V {
+		obj := make(JsonObject)
+		for k, a := range attrs[v.Id] {
+			obj[k] = a
+		}
+		if id, has := obj["id"]; has {
+			obj[OriginalIdAttr] = id
+		}
+		obj["id"] = i
+		obj["label"] = g.Colors[v.Color]
+		data, err := renderJson(obj)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(&buf, "vertex\t%s\n", data)
+	}
+	for _, i := range allEdges(sg, undirected) {
+		e := &sg.E[i]
+		obj := make(JsonObject)
+		for k, a := range edgeAttrs[i] {
+			obj[k] = a
+		}
+		obj["src"] = e.Src
+		obj["targ"] = e.Targ
+		obj["label"] = g.Colors[e.Color]
+		data, err := renderJson(obj)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(&buf, "edge\t%s\n", data)
+	}
+	return buf.Bytes()
+}
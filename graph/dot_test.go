@@ -0,0 +1,48 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"reflect"
+	"testing"
+)
+
+import (
+	"github.com/timtadh/goiso"
+)
+
+func TestUndirectedEdgesKeepsParallelSelfLoops(t *testing.T) {
+	sg := &goiso.SubGraph{
+		V: []goiso.Vertex{{Idx: 0}, {Idx: 1}},
+		E: []goiso.Edge{
+			{Arc: goiso.Arc{Src: 0, Targ: 0}, Idx: 0, Color: 2},
+			{Arc: goiso.Arc{Src: 0, Targ: 1}, Idx: 1, Color: 3},
+			{Arc: goiso.Arc{Src: 0, Targ: 0}, Idx: 2, Color: 2},
+			{Arc: goiso.Arc{Src: 1, Targ: 0}, Idx: 3, Color: 3},
+		},
+	}
+	if edges := undirectedEdges(sg); !reflect.DeepEqual(edges, []int{0, 1, 2}) {
+		t.Errorf("expected the edges [0 1 2] got %v", edges)
+	}
+}
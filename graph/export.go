@@ -0,0 +1,507 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/fs2/bptree"
+	"github.com/timtadh/goiso"
+)
+
+// ExportFormats are the formats an Export can be written in.
+var ExportFormats = []string{"veg", "graphml", "dot", "csv", "gspan"}
+
+// Export is (part of) a loaded graph to be written out in another format.
+type Export struct {
+	G            *goiso.Graph
+	Vertices     []int                    // indices into G.V of the vertices to write
+	Edges        []int                    // indices into G.E of the edges to write
+	VertexAttrs  func(idx int) JsonObject // may be nil
+	EdgeAttrs    func(idx int) JsonObject // may be nil
+	Transactions map[int]string           // may be nil, see WriteGSpan
+	Undirected   bool
+	ids          []interface{} // the id written for each vertex of G
+}
+
+// NewExport is an Export of every vertex and edge of g. Its edges are
+// those connecting the vertices kept by keep (which may be nil). If
+// undirected only one arc of each pair of opposing arcs is kept.
+func NewExport(g *goiso.Graph, keep []bool, undirected bool) *Export {
+	x := &Export{G: g, Undirected: undirected}
+	for i := range g.V {
+		if keep == nil || keep[i] {
+			x.Vertices = append(x.Vertices, i)
+		}
+	}
+	type key struct{ u, v, color int }
+	seen := make(map[key]int)
+	for i := range g.E {
+		e := &g.E[i]
+		if keep != nil && (!keep[e.Src] || !keep[e.Targ]) {
+			continue
+		}
+		if undirected {
+			k := key{e.Src, e.Targ, e.Color}
+			if e.Targ < e.Src {
+				k = key{e.Targ, e.Src, e.Color}
+			}
+			seen[k]++
+			if seen[k]%2 == 0 {
+				continue
+			}
+		}
+		x.Edges = append(x.Edges, i)
+	}
+	return x
+}
+
+// ConnectedComponents numbers the (weakly) connected components of the
+// vertices of g kept by keep (which may be nil). The components are
+// numbered from the largest to the smallest. Vertices which are not kept
+// are in component -1.
+func ConnectedComponents(g *goiso.Graph, keep []bool) (components []int, sizes []int) {
+	parent := make([]int, len(g.V))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := range g.E {
+		e := &g.E[i]
+		if keep != nil && (!keep[e.Src] || !keep[e.Targ]) {
+			continue
+		}
+		if a, b := find(e.Src), find(e.Targ); a != b {
+			parent[a] = b
+		}
+	}
+	count := make(map[int]int)
+	for i := range g.V {
+		if keep == nil || keep[i] {
+			count[find(i)]++
+		}
+	}
+	roots := make([]int, 0, len(count))
+	for root := range count {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if count[roots[i]] != count[roots[j]] {
+			return count[roots[i]] > count[roots[j]]
+		}
+		return roots[i] < roots[j]
+	})
+	number := make(map[int]int, len(roots))
+	sizes = make([]int, len(roots))
+	for n, root := range roots {
+		number[root] = n
+		sizes[n] = count[root]
+	}
+	components = make([]int, len(g.V))
+	for i := range g.V {
+		if keep == nil || keep[i] {
+			components[i] = number[find(i)]
+		} else {
+			components[i] = -1
+		}
+	}
+	return components, sizes
+}
+
+// TreeAttrs reads the attributes stored for idx in an attribute tree
+// (such as the Loader's NodeAttrs or EdgeAttrs). It is nil if there are
+// none.
+func TreeAttrs(bpt *bptree.BpTree, idx int) (obj JsonObject, err error) {
+	bid := make([]byte, 4)
+	binary.BigEndian.PutUint32(bid, uint32(idx))
+	err = bpt.DoFind(bid, func(key, value []byte) error {
+		obj, err = ParseJson(value)
+		return err
+	})
+	return obj, err
+}
+
+// Write writes the export in format (one of the ExportFormats).
+func (x *Export) Write(w io.Writer, format string) error {
+	switch format {
+	case "veg":
+		return x.WriteVeg(w)
+	case "graphml":
+		return x.WriteGraphML(w)
+	case "dot":
+		return x.WriteDot(w)
+	case "csv":
+		return x.WriteCSV(w)
+	case "gspan":
+		return x.WriteGSpan(w)
+	}
+	return fmt.Errorf("unknown output format %q (expected one of %v)", format, strings.Join(ExportFormats, ", "))
+}
+
+// id is the id written for the vertex idx. It is the id the vertex was
+// loaded with (its "id" attribute, which may be a string) unless those
+// are not unique in which case it is idx.
+func (x *Export) id(idx int) interface{} {
+	if x.ids == nil {
+		x.ids = make([]interface{}, len(x.G.V))
+		for i := range x.G.V {
+			x.ids[i] = x.G.V[i].Id
+		}
+		for _, i := range x.Vertices {
+			if id, has := x.vertexAttrs(i)["id"]; has {
+				x.ids[i] = id
+			}
+		}
+		seen := make(map[string]bool, len(x.Vertices))
+		for _, i := range x.Vertices {
+			id := fmt.Sprint(x.ids[i])
+			if seen[id] {
+				for i := range x.ids {
+					x.ids[i] = i
+				}
+				break
+			}
+			seen[id] = true
+		}
+	}
+	return x.ids[idx]
+}
+
+// dotNode is the DOT name of the vertex idx. A plain non-negative integer
+// id is written as n<id> and any other id is quoted.
+func (x *Export) dotNode(idx int) string {
+	switch id := x.id(idx).(type) {
+	case int:
+		if id >= 0 {
+			return fmt.Sprintf("n%d", id)
+		}
+	case json.Number:
+		if isIntLiteral(string(id)) && !strings.HasPrefix(string(id), "-") {
+			return "n" + string(id)
+		}
+	}
+	return strconv.Quote(fmt.Sprint(x.id(idx)))
+}
+
+func (x *Export) vertexAttrs(idx int) JsonObject {
+	if x.VertexAttrs == nil {
+		return nil
+	}
+	return x.VertexAttrs(idx)
+}
+
+func (x *Export) edgeAttrs(idx int) JsonObject {
+	if x.EdgeAttrs == nil {
+		return nil
+	}
+	return x.EdgeAttrs(idx)
+}
+
+// WriteVeg writes the export as veg keeping the attributes of the
+// vertices and edges.
+func (x *Export) WriteVeg(w io.Writer) error {
+	write := func(kind string, data []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\t%s\n", kind, data)
+		return err
+	}
+	for _, i := range x.Vertices {
+		v := &x.G.V[i]
+		attrs := x.vertexAttrs(i)
+		var data []byte
+		var err error
+		if attrs == nil && x.id(i) == v.Id {
+			data, err = SerializeVertex(x.G, v)
+		} else {
+			obj := make(JsonObject)
+			for k, a := range attrs {
+				obj[k] = a
+			}
+			obj["id"] = x.id(i)
+			obj["label"] = x.G.Colors[v.Color]
+			data, err = renderJson(obj)
+		}
+		if err := write("vertex", data, err); err != nil {
+			return err
+		}
+	}
+	for _, i := range x.Edges {
+		e := &x.G.E[i]
+		attrs := x.edgeAttrs(i)
+		var data []byte
+		var err error
+		if attrs == nil && x.id(e.Src) == x.G.V[e.Src].Id && x.id(e.Targ) == x.G.V[e.Targ].Id {
+			data, err = SerializeEdge(x.G, e)
+		} else {
+			obj := make(JsonObject)
+			for k, a := range attrs {
+				obj[k] = a
+			}
+			obj["src"] = x.id(e.Src)
+			obj["targ"] = x.id(e.Targ)
+			obj["label"] = x.G.Colors[e.Color]
+			data, err = renderJson(obj)
+		}
+		if err := write("edge", data, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attrString is the attribute value a as text.
+func attrString(a interface{}) string {
+	switch v := a.(type) {
+	case string:
+		return v
+	case json.Number, bool, int, int64, float64:
+		return fmt.Sprint(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// attrKeys is the sorted names of the attributes (other than skip) of the
+// objects returned by attrs for each of idxs.
+func attrKeys(idxs []int, attrs func(int) JsonObject, skip ...string) []string {
+	set := make(map[string]bool)
+	for _, i := range idxs {
+		for k := range attrs(i) {
+			set[k] = true
+		}
+	}
+	for _, s := range skip {
+		delete(set, s)
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteGraphML writes the export as GraphML. The label and the other
+// attributes become data elements (with string values).
+func (x *Export) WriteGraphML(w io.Writer) error {
+	vkeys := attrKeys(x.Vertices, x.vertexAttrs, "id", "label")
+	ekeys := attrKeys(x.Edges, x.edgeAttrs, "id", "src", "targ", "label")
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="label" for="all" attr.name="label" attr.type="string"/>` + "\n")
+	for i, k := range vkeys {
+		fmt.Fprintf(&b, "  <key id=\"v%d\" for=\"node\" attr.name=\"%s\" attr.type=\"string\"/>\n", i, esc(k))
+	}
+	for i, k := range ekeys {
+		fmt.Fprintf(&b, "  <key id=\"e%d\" for=\"edge\" attr.name=\"%s\" attr.type=\"string\"/>\n", i, esc(k))
+	}
+	edgedefault := "directed"
+	if x.Undirected {
+		edgedefault = "undirected"
+	}
+	fmt.Fprintf(&b, "  <graph id=\"G\" edgedefault=\"%s\">\n", edgedefault)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	data := func(b *strings.Builder, key string, value interface{}) {
+		fmt.Fprintf(b, "      <data key=\"%s\">%s</data>\n", key, esc(attrString(value)))
+	}
+	for _, i := range x.Vertices {
+		v := &x.G.V[i]
+		attrs := x.vertexAttrs(i)
+		b.Reset()
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", esc(fmt.Sprint(x.id(i))))
+		data(&b, "label", x.G.Colors[v.Color])
+		for j, k := range vkeys {
+			if a, has := attrs[k]; has {
+				data(&b, fmt.Sprintf("v%d", j), a)
+			}
+		}
+		b.WriteString("    </node>\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	for _, i := range x.Edges {
+		e := &x.G.E[i]
+		attrs := x.edgeAttrs(i)
+		b.Reset()
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\">\n", esc(fmt.Sprint(x.id(e.Src))), esc(fmt.Sprint(x.id(e.Targ))))
+		data(&b, "label", x.G.Colors[e.Color])
+		for j, k := range ekeys {
+			if a, has := attrs[k]; has {
+				data(&b, fmt.Sprintf("e%d", j), a)
+			}
+		}
+		b.WriteString("    </edge>\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "  </graph>\n</graphml>\n")
+	return err
+}
+
+// WriteDot writes the export in the DOT language with the attributes of
+// the vertices and edges as DOT attributes.
+func (x *Export) WriteDot(w io.Writer) error {
+	kind, arrow := "digraph", "->"
+	if x.Undirected {
+		kind, arrow = "graph", "--"
+	}
+	if _, err := fmt.Fprintf(w, "%s {\n", kind); err != nil {
+		return err
+	}
+	for _, i := range x.Vertices {
+		v := &x.G.V[i]
+		_, err := fmt.Fprintf(w, "    %s [label=%s%s];\n", x.dotNode(i), strconv.Quote(x.G.Colors[v.Color]), dotAttrs(x.vertexAttrs(i), "id", "label"))
+		if err != nil {
+			return err
+		}
+	}
+	for _, i := range x.Edges {
+		e := &x.G.E[i]
+		_, err := fmt.Fprintf(w, "    %s %s %s [label=%s%s];\n", x.dotNode(e.Src), arrow, x.dotNode(e.Targ), strconv.Quote(x.G.Colors[e.Color]), dotAttrs(x.edgeAttrs(i), "src", "targ", "label"))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteCSV writes the edges of the export as a CSV edge list with the
+// columns src, src_label, targ, targ_label and label. Vertices without
+// edges are not written.
+func (x *Export) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"src", "src_label", "targ", "targ_label", "label"})
+	for _, i := range x.Edges {
+		e := &x.G.E[i]
+		c.Write([]string{
+			fmt.Sprint(x.id(e.Src)),
+			x.G.Colors[x.G.V[e.Src].Color],
+			fmt.Sprint(x.id(e.Targ)),
+			x.G.Colors[x.G.V[e.Targ].Color],
+			x.G.Colors[e.Color],
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// gspanLabel is label as a single gSpan field. gSpan labels are whitespace
+// delimited and can not be empty.
+func gspanLabel(label string) string {
+	label = strings.Join(strings.Fields(label), "_")
+	if label == "" {
+		return "_"
+	}
+	return label
+}
+
+// WriteGSpan writes the export in the gSpan format. If the export has
+// Transactions each is written as its own graph otherwise the export is
+// written as a single graph. An edge between two transactions can not be
+// written and is an error. The attributes are not written.
+//
+// Every edge is written as an e line which gSpan (and FSG and Gaston) read
+// as an undirected edge. Only the export of an Undirected graph is
+// standard gSpan: a directed export writes each arc as an e line from src
+// to targ so its directions are only kept when it is read back as arcs
+// (without --undirected).
+func (x *Export) WriteGSpan(w io.Writer) error {
+	var names []string
+	groups := make(map[string][]int)
+	for _, i := range x.Vertices {
+		t := ""
+		if x.Transactions != nil {
+			t = x.Transactions[i]
+		}
+		if _, has := groups[t]; !has {
+			names = append(names, t)
+		}
+		groups[t] = append(groups[t], i)
+	}
+	edges := make(map[string][]int)
+	for _, i := range x.Edges {
+		t := ""
+		if x.Transactions != nil {
+			e := &x.G.E[i]
+			t = x.Transactions[e.Src]
+			if targ := x.Transactions[e.Targ]; targ != t {
+				return fmt.Errorf("the edge %d goes from the transaction %q to %q which gSpan can not represent", i, t, targ)
+			}
+		}
+		edges[t] = append(edges[t], i)
+	}
+	local := make(map[int]int)
+	for tid, name := range names {
+		if _, err := fmt.Fprintf(w, "t # %d\n", tid); err != nil {
+			return err
+		}
+		for n, i := range groups[name] {
+			local[i] = n
+			if _, err := fmt.Fprintf(w, "v %d %s\n", n, gspanLabel(x.G.Colors[x.G.V[i].Color])); err != nil {
+				return err
+			}
+		}
+		for _, i := range edges[name] {
+			e := &x.G.E[i]
+			if _, err := fmt.Fprintf(w, "e %d %d %s\n", local[e.Src], local[e.Targ], gspanLabel(x.G.Colors[e.Color])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
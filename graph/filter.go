@@ -0,0 +1,127 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ExcludedAttr marks the vertices in the node attributes which were
+// excluded from the graph. ExcludedEdgesAttr lists the edges dropped along
+// with them and, on the vertices of the graph, the edges from them dropped
+// by the edge filter.
+const (
+	ExcludedAttr      = "excluded"
+	ExcludedEdgesAttr = "excluded_edges"
+)
+
+// A LabelFilter matches labels against a set of literal labels and
+// regular expressions.
+type LabelFilter struct {
+	literals map[string]bool
+	regexes  []*regexp.Regexp
+}
+
+func NewLabelFilter() *LabelFilter {
+	return &LabelFilter{literals: make(map[string]bool)}
+}
+
+// Add a pattern to the filter. A pattern of the form /regex/ is a regular
+// expression (which must match somewhere in the label), @path adds each
+// line of the file at path as a pattern and anything else is a literal
+// label.
+func (f *LabelFilter) Add(pattern string) error {
+	if strings.HasPrefix(pattern, "@") {
+		return f.AddFile(pattern[1:])
+	} else if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return err
+		}
+		f.regexes = append(f.regexes, re)
+		return nil
+	}
+	f.literals[pattern] = true
+	return nil
+}
+
+// AddFile adds every line of the file as a pattern. Blank lines and lines
+// starting with # are skipped.
+func (f *LabelFilter) AddFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var errors ParseErrors
+	lineno := 0
+	err = ProcessLinesUntil(file, func(line []byte) bool {
+		lineno++
+		pattern := strings.TrimRight(string(line), "\r\n")
+		if strings.TrimSpace(pattern) == "" || strings.HasPrefix(pattern, "#") {
+			return true
+		}
+		if err := f.Add(pattern); err != nil {
+			errors = append(errors, &ParseError{File: path, Line: lineno, Text: pattern, Err: err})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	} else if len(errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+// Match is true if the label matches any pattern. A nil filter matches
+// nothing.
+func (f *LabelFilter) Match(label string) bool {
+	if f == nil {
+		return false
+	}
+	if f.literals[label] {
+		return true
+	}
+	for _, re := range f.regexes {
+		if re.MatchString(label) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *LabelFilter) String() string {
+	var s []string
+	for label := range f.literals {
+		s = append(s, fmt.Sprintf("%q", label))
+	}
+	for _, re := range f.regexes {
+		s = append(s, "/"+re.String()+"/")
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,121 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+type Format int
+
+const (
+	UnknownFormat Format = iota
+	VegFormat
+	GSpanFormat
+	GraphMLFormat
+	GMLFormat
+)
+
+var formatNames = map[Format]string{
+	UnknownFormat: "unknown",
+	VegFormat:     "veg",
+	GSpanFormat:   "gspan",
+	GraphMLFormat: "graphml",
+	GMLFormat:     "gml",
+}
+
+var formatExts = map[string]Format{
+	".veg":     VegFormat,
+	".gspan":   GSpanFormat,
+	".fsg":     GSpanFormat,
+	".gaston":  GSpanFormat,
+	".graphml": GraphMLFormat,
+	".gml":     GMLFormat,
+}
+
+var compressionExts = []string{".gz", ".bz2", ".xz", ".zst", ".zstd"}
+
+func (f Format) String() string {
+	return formatNames[f]
+}
+
+// ParseFormat is the Format with the given name (as returned by String).
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name && f != UnknownFormat {
+			return f, nil
+		}
+	}
+	return UnknownFormat, fmt.Errorf("unknown graph format %q", name)
+}
+
+// DetectFormat guesses the format of the file called name from its
+// extension (ignoring any compression extension) and if that fails from
+// head, the first few bytes of the file.
+func DetectFormat(name string, head []byte) Format {
+	name = strings.ToLower(name)
+	for _, ext := range compressionExts {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if f, has := formatExts[path.Ext(name)]; has {
+		return f
+	}
+	if isGraphML(head) {
+		return GraphMLFormat
+	} else if isGML(head) {
+		return GMLFormat
+	} else if isGSpan(head) {
+		return GSpanFormat
+	}
+	return VegFormat
+}
+
+// Load reads the graph in reader into the Loader detecting its format with
+// DetectFormat.
+func (l *Loader) Load(name string, reader io.Reader) error {
+	buf := bufio.NewReader(reader)
+	head, _ := buf.Peek(4096)
+	return l.LoadFormat(DetectFormat(name, head), name, buf)
+}
+
+// LoadFormat reads the graph in reader into the Loader. format must not be
+// UnknownFormat.
+func (l *Loader) LoadFormat(format Format, name string, reader io.Reader) error {
+	switch format {
+	case VegFormat:
+		return l.Veg(name, reader)
+	case GSpanFormat:
+		return l.GSpan(name, reader)
+	case GraphMLFormat:
+		return l.GraphML(name, reader)
+	case GMLFormat:
+		return l.GML(name, reader)
+	default:
+		return fmt.Errorf("can not load graph format %v", format)
+	}
+}
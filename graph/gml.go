@@ -0,0 +1,237 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"unicode"
+)
+
+type gmlScanner struct {
+	reader *bufio.Reader
+	line   int
+}
+
+type gmlToken struct {
+	kind  byte // 'k' key, 'n' number, 's' string, '[', ']' or 0 at EOF
+	value string
+}
+
+func (s *gmlScanner) next() (gmlToken, error) {
+	for {
+		r, _, err := s.reader.ReadRune()
+		if err == io.EOF {
+			return gmlToken{}, nil
+		} else if err != nil {
+			return gmlToken{}, err
+		}
+		switch {
+		case r == '\n':
+			s.line++
+		case unicode.IsSpace(r):
+		case r == '#':
+			if _, err := s.reader.ReadString('\n'); err != nil && err != io.EOF {
+				return gmlToken{}, err
+			}
+			s.line++
+		case r == '[' || r == ']':
+			return gmlToken{kind: byte(r)}, nil
+		case r == '"':
+			var buf bytes.Buffer
+			for {
+				r, _, err := s.reader.ReadRune()
+				if err == io.EOF {
+					return gmlToken{}, fmt.Errorf("unterminated string")
+				} else if err != nil {
+					return gmlToken{}, err
+				} else if r == '"' {
+					break
+				} else if r == '\n' {
+					s.line++
+				}
+				buf.WriteRune(r)
+			}
+			return gmlToken{kind: 's', value: buf.String()}, nil
+		default:
+			var buf bytes.Buffer
+			buf.WriteRune(r)
+			for {
+				r, _, err := s.reader.ReadRune()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return gmlToken{}, err
+				} else if unicode.IsSpace(r) || r == '[' || r == ']' {
+					s.reader.UnreadRune()
+					break
+				}
+				buf.WriteRune(r)
+			}
+			word := buf.String()
+			if word[0] == '-' || word[0] == '+' || word[0] == '.' || unicode.IsDigit(rune(word[0])) {
+				return gmlToken{kind: 'n', value: word}, nil
+			}
+			return gmlToken{kind: 'k', value: word}, nil
+		}
+	}
+}
+
+// value reads the value following a key. Lists become JsonObjects.
+func (s *gmlScanner) value() (interface{}, error) {
+	t, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case 's':
+		return t.value, nil
+	case 'n':
+		return json.Number(t.value), nil
+	case '[':
+		return s.list()
+	default:
+		return nil, fmt.Errorf("expected a value got %q", t.value)
+	}
+}
+
+// list reads the rest of a list (after the opening bracket).
+func (s *gmlScanner) list() (JsonObject, error) {
+	obj := make(JsonObject)
+	for {
+		t, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		switch t.kind {
+		case ']':
+			return obj, nil
+		case 'k':
+			v, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			obj[t.value] = v
+		default:
+			return nil, fmt.Errorf("expected a key got %q", t.value)
+		}
+	}
+}
+
+// GML reads a graph in the Graph Modelling Language. The attributes of
+// each node (including nested lists like graphics) become the vertex
+// attributes from which the VertexLabel is built. Edges are labeled by
+// their EdgeLabel. A syntax error always stops the load.
+func (l *Loader) GML(name string, reader io.Reader) error {
+	s := &gmlScanner{reader: bufio.NewReader(reader), line: 1}
+	var edges []pendingEdge
+	fail := func(err error) error {
+		return &ParseError{File: name, Line: s.line, Err: err}
+	}
+	record := func(err error) error {
+		return l.error(&ParseError{File: name, Line: s.line, Err: err})
+	}
+	for {
+		t, err := s.next()
+		if err != nil {
+			return fail(err)
+		} else if t.kind == 0 {
+			break
+		} else if t.kind != 'k' {
+			return fail(fmt.Errorf("expected a key got %q", t.value))
+		} else if t.value != "graph" {
+			if _, err := s.value(); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		if t, err := s.next(); err != nil {
+			return fail(err)
+		} else if t.kind != '[' {
+			return fail(fmt.Errorf("expected graph [ got %q", t.value))
+		}
+	items:
+		for {
+			t, err := s.next()
+			if err != nil {
+				return fail(err)
+			}
+			switch t.kind {
+			case ']':
+				break items
+			case 'k':
+			default:
+				return fail(fmt.Errorf("expected a key got %q", t.value))
+			}
+			v, err := s.value()
+			if err != nil {
+				return fail(err)
+			}
+			obj, isList := v.(JsonObject)
+			if !isList || (t.value != "node" && t.value != "edge") {
+				continue
+			}
+			if t.value == "node" {
+				id, has := obj["id"]
+				if !has {
+					err = fmt.Errorf("node without an id")
+				} else {
+					sid := fmt.Sprint(id)
+					err = l.vertexObj(name, vertexKey(name, sid), l.vertexId(sid), obj)
+				}
+				if err != nil {
+					if err := record(err); err != nil {
+						return err
+					}
+				}
+			} else {
+				src, hasSrc := obj["source"]
+				targ, hasTarg := obj["target"]
+				if !hasSrc || !hasTarg {
+					if err := record(fmt.Errorf("edge without a source or target")); err != nil {
+						return err
+					}
+					continue
+				}
+				edges = append(edges, pendingEdge{
+					line: s.line,
+					src:  vertexKey(name, fmt.Sprint(src)),
+					targ: vertexKey(name, fmt.Sprint(targ)),
+					obj:  obj,
+				})
+			}
+		}
+	}
+	return l.pendingEdges(name, edges)
+}
+
+var gmlHead = regexp.MustCompile(`(?m)^\s*graph\s*\[`)
+
+func isGML(head []byte) bool {
+	return gmlHead.Match(head)
+}
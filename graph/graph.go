@@ -29,6 +29,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -55,18 +57,57 @@ func (self error_list) Error() string {
 func (self ParseErrors) Error() string     { return error_list(self).Error() }
 func (self SerializeErrors) Error() string { return error_list(self).Error() }
 
+// ParseError is a problem with a single line of the input.
+type ParseError struct {
+	File string
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %v: %q", e.Line, e.Err, e.Text)
+	}
+	return fmt.Sprintf("%v:%d: %v: %q", e.File, e.Line, e.Err, e.Text)
+}
+
+// TooManyErrors is returned when loading was aborted because the input
+// had more bad lines than were allowed.
+type TooManyErrors struct {
+	Max    int
+	Errors ParseErrors
+}
+
+func (e *TooManyErrors) Error() string {
+	return fmt.Sprintf("aborted after %d bad lines (max-errors %d), last error %v",
+		len(e.Errors), e.Max, e.Errors[len(e.Errors)-1])
+}
+
 func ProcessLines(reader io.Reader, process func([]byte)) {
+	err := ProcessLinesUntil(reader, func(line []byte) bool {
+		process(line)
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ProcessLinesUntil calls process for each line in reader until either
+// the reader is exhausted or process returns false.
+func ProcessLinesUntil(reader io.Reader, process func([]byte) bool) error {
 
 	const SIZE = 4096
 
-	read_chunk := func() (chunk []byte, closed bool) {
-		chunk = make([]byte, 4096)
+	read_chunk := func() (chunk []byte, closed bool, err error) {
+		chunk = make([]byte, SIZE)
 		if n, err := reader.Read(chunk); err == io.EOF {
-			return nil, true
+			return chunk[:n], true, nil
 		} else if err != nil {
-			panic(err)
+			return nil, true, err
 		} else {
-			return chunk[:n], false
+			return chunk[:n], false, nil
 		}
 	}
 
@@ -82,26 +123,37 @@ func ProcessLines(reader io.Reader, process func([]byte)) {
 	}
 
 	var buf []byte
-	read_line := func() (line []byte, closed bool) {
+	eof := false
+	read_line := func() (line []byte, closed bool, err error) {
 		ok := false
 		buf, line, ok = parse(buf)
 		for !ok {
-			chunk, closed := read_chunk()
-			if closed || len(chunk) == 0 {
-				return buf, true
+			if eof {
+				return buf, true, nil
+			}
+			chunk, closed, err := read_chunk()
+			if err != nil {
+				return nil, true, err
 			}
+			eof = closed
 			buf = append(buf, chunk...)
 			buf, line, ok = parse(buf)
 		}
-		return line, false
+		return line, false, nil
 	}
 
-	var line []byte
 	closed := false
 	for !closed {
-		line, closed = read_line()
-		process(line)
+		line, c, err := read_line()
+		if err != nil {
+			return err
+		}
+		closed = c
+		if !process(line) {
+			return nil
+		}
 	}
+	return nil
 }
 
 func renderJson(obj JsonObject) (data []byte, err error) {
@@ -117,6 +169,136 @@ func ParseJson(data []byte) (obj JsonObject, err error) {
 	return obj, nil
 }
 
+// jsonId is the vertex id stored in obj[key] as text. An id is either a
+// string or an integer of any size (so 64 bit hashes are not truncated).
+func jsonId(obj JsonObject, key string) (string, error) {
+	o, has := obj[key]
+	if !has {
+		return "", fmt.Errorf("missing required field %q", key)
+	}
+	switch id := o.(type) {
+	case json.Number:
+		if strings.ContainsAny(string(id), ".eE") {
+			return "", fmt.Errorf("expected %q to be an integer or a string got %v", key, id)
+		}
+		return string(id), nil
+	case string:
+		if id == "" {
+			return "", fmt.Errorf("the %q is empty", key)
+		}
+		return id, nil
+	default:
+		return "", fmt.Errorf("expected %q to be an integer or a string got %v", key, o)
+	}
+}
+
+func jsonString(obj JsonObject, key string) (string, error) {
+	o, has := obj[key]
+	if !has {
+		return "", fmt.Errorf("missing required field %q", key)
+	}
+	str, ok := o.(string)
+	if !ok {
+		return "", fmt.Errorf("expected %q to be a string got %v", key, o)
+	}
+	return str, nil
+}
+
+// jsonLabel is the label stored in obj[key]. Any JSON scalar is accepted
+// and put in its canonical form (see canonicalLabel).
+func jsonLabel(obj JsonObject, key string) (string, error) {
+	o, has := obj[key]
+	if !has {
+		return "", fmt.Errorf("missing required field %q", key)
+	}
+	label, ok := canonicalLabel(o)
+	if !ok {
+		return "", fmt.Errorf("expected %q to be a string or number got %v", key, o)
+	}
+	return label, nil
+}
+
+// jsonLabels is the labels stored in obj[key] which may be either a
+// scalar or an array of scalars.
+func jsonLabels(obj JsonObject, key string) ([]string, error) {
+	o, has := obj[key]
+	if !has {
+		return nil, fmt.Errorf("missing required field %q", key)
+	}
+	list, ok := o.([]interface{})
+	if !ok {
+		label, err := jsonLabel(obj, key)
+		if err != nil {
+			return nil, err
+		}
+		return []string{label}, nil
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("expected %q to have at least one label", key)
+	}
+	labels := make([]string, 0, len(list))
+	for _, item := range list {
+		label, ok := canonicalLabel(item)
+		if !ok {
+			return nil, fmt.Errorf("expected the items of %q to be strings or numbers got %v", key, item)
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// canonicalLabel is the label for the JSON scalar o. Numbers are written
+// in their shortest form with integral values below 2^63 in magnitude
+// written as integers (so 1, 1.0 and 1e0 are all "1"). Integers too large
+// for an int64 are kept as written so distinct integers stay distinct.
+// null is the empty label.
+func canonicalLabel(o interface{}) (string, bool) {
+	switch v := o.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return strconv.FormatInt(i, 10), true
+		} else if isIntLiteral(string(v)) {
+			return string(v), true
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return string(v), true
+		}
+		return canonicalLabel(f)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return strconv.FormatInt(int64(v), 10), true
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// isIntLiteral is true if the JSON number s is written as an integer.
+func isIntLiteral(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func parseLine(line []byte) (line_type string, data []byte) {
 	split := bytes.Split(line, []byte("\t"))
 	return strings.TrimSpace(string(split[0])), bytes.TrimSpace(split[1])
@@ -139,27 +321,28 @@ func LoadGraph(getInput func() (io.Reader, func()), supportAttr string, nodeAttr
 	G := goiso.NewGraph(graphSize(reader))
 	closer()
 	graph = &G
-	vids := hashtable.NewLinearHash() // int64 ==> *goiso.Vertex
+	vids := hashtable.NewLinearHash() // id ==> *goiso.Vertex
 
 	reader, closer = getInput()
 	defer closer()
+	lineno := 0
 	ProcessLines(reader, func(line []byte) {
+		lineno++
 		if len(line) == 0 || !bytes.Contains(line, []byte("\t")) {
 			return
 		}
 		line_type, data := parseLine(line)
+		var err error
 		switch line_type {
 		case "vertex":
-			if err := LoadVertex(graph, supportAttr, vids, nodeAttrs, supportAttrs, data); err != nil {
-				errors = append(errors, err)
-			}
+			err = LoadVertex(graph, supportAttr, vids, nodeAttrs, supportAttrs, data)
 		case "edge":
-			if err := LoadEdge(graph, vids, data); err != nil {
-				errors = append(errors, err)
-			}
+			err = LoadEdge(graph, vids, data)
 		default:
-			errors = append(errors, fmt.Errorf("Unknown line type %v", line_type))
-			return
+			err = fmt.Errorf("Unknown line type %v", line_type)
+		}
+		if err != nil {
+			errors = append(errors, &ParseError{Line: lineno, Text: string(line), Err: err})
 		}
 	})
 	if len(errors) == 0 {
@@ -173,14 +356,21 @@ func LoadVertex(g *goiso.Graph, supportAttr string, vids types.Map, nodeAttrs *b
 	if err != nil {
 		return err
 	}
-	_id, err := obj["id"].(json.Number).Int64()
+	_id, err := jsonId(obj, "id")
 	if err != nil {
 		return err
 	}
-	label := strings.TrimSpace(obj["label"].(string))
-	id := int(_id)
+	label, err := jsonLabel(obj, "label")
+	if err != nil {
+		return err
+	}
+	label = strings.TrimSpace(label)
+	id, err := strconv.Atoi(_id)
+	if err != nil {
+		id = len(g.V)
+	}
 	vertex := g.AddVertex(id, label)
-	err = vids.Put(types.Int(id), vertex)
+	err = vids.Put(types.String(_id), vertex)
 	if err != nil {
 		return err
 	}
@@ -192,10 +382,11 @@ func LoadVertex(g *goiso.Graph, supportAttr string, vids types.Map, nodeAttrs *b
 			return err
 		}
 		if supportAttr != "" {
-			if _, has := obj[supportAttr]; !has {
-				return fmt.Errorf("vertex did not have required supportAttr %v\n%v", supportAttr, string(data))
+			attr, err := jsonString(obj, supportAttr)
+			if err != nil {
+				return fmt.Errorf("vertex did not have required supportAttr %v: %v", supportAttr, err)
 			}
-			supportAttrs[vertex.Idx] = obj[supportAttr].(string)
+			supportAttrs[vertex.Idx] = attr
 		}
 	}
 	return nil
@@ -213,23 +404,25 @@ func LoadEdge(g *goiso.Graph, vids types.Map, data []byte) (err error) {
 	if err != nil {
 		return err
 	}
-	_src, err := obj["src"].(json.Number).Int64()
+	src, err := jsonId(obj, "src")
 	if err != nil {
 		return err
 	}
-	_targ, err := obj["targ"].(json.Number).Int64()
+	targ, err := jsonId(obj, "targ")
 	if err != nil {
 		return err
 	}
-	src := int(_src)
-	targ := int(_targ)
-	label := strings.TrimSpace(obj["label"].(string))
-	if o, err := vids.Get(types.Int(src)); err != nil {
+	label, err := jsonLabel(obj, "label")
+	if err != nil {
 		return err
+	}
+	label = strings.TrimSpace(label)
+	if o, err := vids.Get(types.String(src)); err != nil {
+		return fmt.Errorf("edge src %v is not a known vertex", src)
 	} else {
 		u := o.(*goiso.Vertex)
-		if o, err := vids.Get(types.Int(targ)); err != nil {
-			return err
+		if o, err := vids.Get(types.String(targ)); err != nil {
+			return fmt.Errorf("edge targ %v is not a known vertex", targ)
 		} else {
 			v := o.(*goiso.Vertex)
 			g.AddEdge(u, v, label)
@@ -0,0 +1,245 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/data-structures/types"
+)
+
+type graphmlKey struct {
+	name       string
+	typ        string
+	domain     string
+	def        interface{}
+	hasDefault bool
+}
+
+func (k *graphmlKey) appliesTo(kind string) bool {
+	return k.domain == "" || k.domain == "all" || k.domain == kind
+}
+
+// value converts the text of a data element to the key's attr.type.
+func (k *graphmlKey) value(text string) interface{} {
+	switch k.typ {
+	case "int", "long", "float", "double":
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	}
+	return text
+}
+
+// pendingEdge is an edge waiting for the end of its file before it is
+// added (these formats do not require the vertices to come first).
+type pendingEdge struct {
+	line      int
+	src, targ types.Hashable
+	obj       JsonObject
+}
+
+// vertexKey is the key for a vertex of a file in which the ids are
+// scoped to the whole file.
+func vertexKey(file, id string) types.Hashable {
+	return types.String(file + "\x00" + id)
+}
+
+// vertexId is the goiso id for a vertex with the (possibly non-numeric)
+// id. Ids which are not numbers (or do not fit in an int) get the index of
+// the vertex.
+func (l *Loader) vertexId(id string) int64 {
+	if i, err := strconv.ParseInt(id, 10, strconv.IntSize); err == nil {
+		return i
+	}
+	return int64(len(l.vertices))
+}
+
+func (l *Loader) pendingEdges(name string, edges []pendingEdge) error {
+	for _, e := range edges {
+		labels, err := l.labels(l.EdgeLabel, e.obj, false)
+		if err == nil {
+			err = l.addEdge(e.src, e.targ, labels, e.obj)
+		}
+		if err != nil {
+			if err := l.error(&ParseError{File: name, Line: e.line, Err: err}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GraphML reads a GraphML document. The data of the nodes (named by the
+// attr.name of their keys) become the vertex attributes from which the
+// VertexLabel is built. Edges are labeled by their EdgeLabel. The text
+// of nested elements (such as the yEd NodeLabel) is used as the value of
+// the data element containing them. An error in the XML itself always
+// stops the load.
+func (l *Loader) GraphML(name string, reader io.Reader) error {
+	dec := xml.NewDecoder(reader)
+	keys := make(map[string]*graphmlKey)
+	var edges []pendingEdge
+	var key *graphmlKey  // the key being defined
+	var kind string      // "node" or "edge"
+	var obj JsonObject   // attributes of the current node or edge
+	var data *graphmlKey // key of the data element being read
+	var text bytes.Buffer
+	var src, targ string
+	inText := false
+	line := func() int {
+		line, _ := dec.InputPos()
+		return line
+	}
+	attr := func(e xml.StartElement, name string) (string, bool) {
+		for _, a := range e.Attr {
+			if a.Name.Local == name {
+				return a.Value, true
+			}
+		}
+		return "", false
+	}
+	record := func(err error) error {
+		return l.error(&ParseError{File: name, Line: line(), Err: err})
+	}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return &ParseError{File: name, Line: line(), Err: err}
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "key":
+				id, _ := attr(t, "id")
+				key = &graphmlKey{name: id}
+				if n, has := attr(t, "attr.name"); has {
+					key.name = n
+				}
+				key.typ, _ = attr(t, "attr.type")
+				key.domain, _ = attr(t, "for")
+				keys[id] = key
+			case "default":
+				text.Reset()
+				inText = key != nil
+			case "node", "edge":
+				kind = t.Name.Local
+				obj = make(JsonObject)
+				for _, k := range keys {
+					if k.hasDefault && k.appliesTo(kind) {
+						obj[k.name] = k.def
+					}
+				}
+				if id, has := attr(t, "id"); has {
+					obj["id"] = id
+				}
+				src, _ = attr(t, "source")
+				targ, _ = attr(t, "target")
+			case "data":
+				if obj == nil {
+					continue
+				}
+				k, _ := attr(t, "key")
+				if data = keys[k]; data == nil {
+					data = &graphmlKey{name: k}
+				}
+				text.Reset()
+				inText = true
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "default":
+				if key != nil {
+					key.def = key.value(strings.TrimSpace(text.String()))
+					key.hasDefault = true
+				}
+				inText = false
+			case "key":
+				key = nil
+			case "data":
+				if data != nil {
+					obj[data.name] = data.value(strings.TrimSpace(text.String()))
+				}
+				data = nil
+				inText = false
+			case "node":
+				if obj == nil {
+					continue
+				}
+				id, has := obj["id"].(string)
+				if !has {
+					err = fmt.Errorf("node without an id")
+				} else {
+					err = l.vertexObj(name, vertexKey(name, id), l.vertexId(id), obj)
+				}
+				if err != nil {
+					if err := record(err); err != nil {
+						return err
+					}
+				}
+				obj = nil
+			case "edge":
+				if obj == nil {
+					continue
+				}
+				if src == "" || targ == "" {
+					if err := record(fmt.Errorf("edge without a source or target")); err != nil {
+						return err
+					}
+				} else {
+					edges = append(edges, pendingEdge{
+						line: line(),
+						src:  vertexKey(name, src),
+						targ: vertexKey(name, targ),
+						obj:  obj,
+					})
+				}
+				obj = nil
+			}
+		}
+	}
+	return l.pendingEdges(name, edges)
+}
+
+func isGraphML(head []byte) bool {
+	return bytes.Contains(head, []byte("<graphml"))
+}
@@ -0,0 +1,162 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/data-structures/types"
+)
+
+// TransactionAttr is the vertex attribute holding the transaction a
+// vertex was read from in a transactional input such as gSpan.
+const TransactionAttr = "transaction"
+
+// GSpan reads a database of graphs in the text format used by gSpan, FSG
+// and Gaston:
+//
+//	t # <tid>
+//	v <id> <label>
+//	e <src> <targ> <label>
+//
+// The FSG "u" (undirected) and "d" (directed) edge lines are read as "e"
+// lines. The "e" and "u" edges of these datasets are undirected but unless
+// the Loader is Undirected they are loaded as a single arc (from src to
+// targ) and counted by DirectedGSpanEdges. Vertex ids are scoped to their
+// transaction. Each vertex is given the TransactionAttr so to use the
+// transactions for support set the Loader's SupportAttr to
+// TransactionAttr.
+func (l *Loader) GSpan(name string, reader io.Reader) error {
+	tid := ""
+	return l.lines(name, reader, func(line []byte) error {
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			return nil
+		}
+		vid := func(field string) (types.Hashable, int64, error) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("expected an int vertex id got %q", field)
+			}
+			return types.String(fmt.Sprintf("%s\x00%s\x00%d", name, tid, id)), id, nil
+		}
+		switch fields[0] {
+		case "t":
+			if len(fields) < 2 {
+				return fmt.Errorf("transaction line without an id")
+			}
+			tid = fields[len(fields)-1]
+			return nil
+		case "v":
+			if len(fields) < 3 {
+				return fmt.Errorf("expected: v <id> <label>")
+			}
+			if tid == "" || tid == "-1" {
+				return fmt.Errorf("vertex outside of a transaction")
+			}
+			key, id, err := vid(fields[1])
+			if err != nil {
+				return err
+			}
+			obj := JsonObject{
+				"id":            id,
+				"label":         strings.Join(fields[2:], " "),
+				TransactionAttr: tid,
+			}
+			labels, _ := l.rewrite(obj, []string{obj["label"].(string)}, func(label string) string {
+				return l.Rewrite.Vertex(label)
+			})
+			data, err := renderJson(obj)
+			if err != nil {
+				return err
+			}
+			transaction, err := l.gspanTransaction(name, tid)
+			if err != nil {
+				return err
+			}
+			return l.addVertex(key, id, labels, transaction, data)
+		case "e", "u", "d":
+			if len(fields) < 4 {
+				return fmt.Errorf("expected: %v <src> <targ> <label>", fields[0])
+			}
+			srcKey, _, err := vid(fields[1])
+			if err != nil {
+				return err
+			}
+			targKey, _, err := vid(fields[2])
+			if err != nil {
+				return err
+			}
+			if fields[0] != "d" && !l.Undirected {
+				l.directedGSpan++
+			}
+			return l.addEdge(srcKey, targKey, []string{strings.Join(fields[3:], " ")}, nil)
+		default:
+			return fmt.Errorf("Unknown line type %v", fields[0])
+		}
+	})
+}
+
+// DirectedGSpanEdges is the number of gSpan "e" and "u" edges, which are
+// undirected in that format, loaded as a single arc because the Loader is
+// not Undirected.
+func (l *Loader) DirectedGSpanEdges() int {
+	return l.directedGSpan
+}
+
+// gspanTransaction is the value of the SupportAttr for a vertex in
+// transaction tid of file. The transaction includes the file so it is
+// unique even when several files are loaded.
+func (l *Loader) gspanTransaction(file, tid string) (string, error) {
+	switch l.SupportAttr {
+	case "":
+		return "", nil
+	case FileAttr:
+		return file, nil
+	case TransactionAttr:
+		if file == "" {
+			return tid, nil
+		}
+		return file + "#" + tid, nil
+	default:
+		return "", fmt.Errorf("gspan vertices do not have the supportAttr %v (only %v)", l.SupportAttr, TransactionAttr)
+	}
+}
+
+func isGSpan(head []byte) bool {
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) == 0 || bytes.HasPrefix(fields[0], []byte("#")) {
+			continue
+		}
+		return bytes.Equal(fields[0], []byte("t"))
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type labelPart struct {
+	field   bool
+	literal string // the text or the name of the field
+}
+
+// A LabelExpr builds the label of a vertex or edge from its attributes.
+// It is either the name of a single attribute (eg. "label") or a template
+// in which each {name} is replaced with the value of that attribute (eg.
+// "{kind}:{type}"). Use {{ and }} for literal braces.
+type LabelExpr struct {
+	expr  string
+	parts []labelPart
+}
+
+// DefaultLabel is the label expression used unless one is given.
+var DefaultLabel = MustParseLabelExpr("label")
+
+func ParseLabelExpr(expr string) (*LabelExpr, error) {
+	if !strings.ContainsAny(expr, "{}") {
+		if strings.TrimSpace(expr) == "" {
+			return nil, fmt.Errorf("empty label expression")
+		}
+		return &LabelExpr{expr: expr, parts: []labelPart{{true, expr}}}, nil
+	}
+	e := &LabelExpr{expr: expr}
+	var lit bytes.Buffer
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case strings.HasPrefix(expr[i:], "{{"), strings.HasPrefix(expr[i:], "}}"):
+			lit.WriteByte(expr[i])
+			i++
+		case expr[i] == '{':
+			end := strings.IndexByte(expr[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { in label expression %q", expr)
+			}
+			name := expr[i+1 : i+end]
+			if name == "" || strings.ContainsAny(name, "{") {
+				return nil, fmt.Errorf("bad field name %q in label expression %q", name, expr)
+			}
+			if lit.Len() > 0 {
+				e.parts = append(e.parts, labelPart{false, lit.String()})
+				lit.Reset()
+			}
+			e.parts = append(e.parts, labelPart{true, name})
+			i += end
+		case expr[i] == '}':
+			return nil, fmt.Errorf("unopened } in label expression %q", expr)
+		default:
+			lit.WriteByte(expr[i])
+		}
+	}
+	if lit.Len() > 0 {
+		e.parts = append(e.parts, labelPart{false, lit.String()})
+	}
+	return e, nil
+}
+
+func MustParseLabelExpr(expr string) *LabelExpr {
+	e, err := ParseLabelExpr(expr)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func (e *LabelExpr) String() string {
+	return e.expr
+}
+
+// Label evaluates the expression against obj. If strict a missing
+// attribute is an error otherwise it is the empty string. Multi-valued
+// (array) attributes are an error, see Labels.
+func (e *LabelExpr) Label(obj JsonObject, strict bool) (string, error) {
+	labels, err := e.Labels(obj, strict)
+	if err != nil {
+		return "", err
+	}
+	if len(labels) != 1 {
+		return "", fmt.Errorf("the label %q is multi-valued %v (see --multi-labels)", e.expr, labels)
+	}
+	return labels[0], nil
+}
+
+// Labels evaluates the expression against obj allowing the attributes to
+// be arrays. Each element of an array is an alternative label so a
+// template gets one label for every combination of the alternatives. The
+// labels are distinct and in the order of the arrays.
+func (e *LabelExpr) Labels(obj JsonObject, strict bool) ([]string, error) {
+	labels := []string{""}
+	for _, p := range e.parts {
+		values := []string{p.literal}
+		if p.field {
+			var err error
+			values, err = e.field(obj, p.literal, strict)
+			if err != nil {
+				return nil, err
+			}
+		}
+		next := make([]string, 0, len(labels)*len(values))
+		for _, label := range labels {
+			for _, v := range values {
+				next = append(next, label+v)
+			}
+		}
+		labels = next
+	}
+	return distinct(labels), nil
+}
+
+func (e *LabelExpr) field(obj JsonObject, name string, strict bool) ([]string, error) {
+	if _, has := obj[name]; !has && !strict {
+		return []string{""}, nil
+	}
+	values, err := jsonLabels(obj, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values, nil
+}
+
+// distinct is labels without the repeats.
+func distinct(labels []string) []string {
+	if len(labels) <= 1 {
+		return labels
+	}
+	seen := make(map[string]bool, len(labels))
+	d := labels[:0]
+	for _, label := range labels {
+		if !seen[label] {
+			seen[label] = true
+			d = append(d, label)
+		}
+	}
+	return d
+}
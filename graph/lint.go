@@ -0,0 +1,285 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The checks made by a Linter. Each finding names the check which made it
+// so a check can be skipped.
+const (
+	LintSyntax           = "syntax"             // not a vertex or edge line with a JSON object
+	LintId               = "id"                 // missing or malformed vertex ids
+	LintDuplicateId      = "duplicate-id"       // a vertex id defined twice
+	LintUndefinedVertex  = "undefined-vertex"   // an edge to a vertex which is never defined
+	LintEdgeBeforeVertex = "edge-before-vertex" // an edge to a vertex defined after it
+	LintLabel            = "label"              // missing, array or non-string labels
+	LintLabelWhitespace  = "label-whitespace"   // labels with leading or trailing whitespace
+	LintSelfLoop         = "self-loop"          // an edge from a vertex to itself
+	LintMultiEdge        = "multi-edge"         // several edges between the same vertices
+)
+
+// LintChecks is every check a Linter makes.
+var LintChecks = []string{
+	LintSyntax,
+	LintId,
+	LintDuplicateId,
+	LintUndefinedVertex,
+	LintEdgeBeforeVertex,
+	LintLabel,
+	LintLabelWhitespace,
+	LintSelfLoop,
+	LintMultiEdge,
+}
+
+// A LintFinding is a problem found on a line of a veg file.
+type LintFinding struct {
+	File  string
+	Line  int
+	Check string
+	Msg   string
+	order int // of the file
+}
+
+func (f *LintFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", f.File, f.Line, f.Check, f.Msg)
+}
+
+type lintPos struct {
+	file string
+	line int
+}
+
+// where is the position p as seen from a line of file.
+func (p lintPos) where(file string) string {
+	if p.file == file {
+		return fmt.Sprintf("line %d", p.line)
+	}
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// lintEnd is an end of an edge whose vertex had not been defined yet.
+type lintEnd struct {
+	lintPos
+	order int
+	key   string
+	id    string
+}
+
+// A Linter checks veg files for the problems which would make the Loader
+// reject lines or silently build a different graph than intended. The ids
+// are scoped by Namespace as they are by the Loader so a Linter may be
+// given several files. Call Findings once every file has been linted.
+type Linter struct {
+	Namespace   string
+	Undirected  bool            // edges in either direction are multi-edges
+	MultiLabels bool            // allow array labels
+	Skip        map[string]bool // checks not to make
+	findings    []*LintFinding
+	files       int
+	vertices    map[string]lintPos
+	arcs        map[[2]string]lintPos
+	pending     []lintEnd
+}
+
+func NewLinter() *Linter {
+	return &Linter{
+		Skip:     make(map[string]bool),
+		vertices: make(map[string]lintPos),
+		arcs:     make(map[[2]string]lintPos),
+	}
+}
+
+func (l *Linter) report(pos lintPos, order int, check, format string, args ...interface{}) {
+	if l.Skip[check] {
+		return
+	}
+	l.findings = append(l.findings, &LintFinding{
+		File:  pos.file,
+		Line:  pos.line,
+		Check: check,
+		Msg:   fmt.Sprintf(format, args...),
+		order: order,
+	})
+}
+
+// Lint checks the veg lines of reader. name identifies the file in the
+// findings. An error is only returned if reader could not be read.
+func (l *Linter) Lint(name string, reader io.Reader) error {
+	order := l.files
+	l.files++
+	lineno := 0
+	return ProcessLinesUntil(reader, func(line []byte) bool {
+		lineno++
+		if len(bytes.TrimSpace(line)) > 0 {
+			l.line(lintPos{name, lineno}, order, line)
+		}
+		return true
+	})
+}
+
+func (l *Linter) line(pos lintPos, order int, line []byte) {
+	if !bytes.Contains(line, []byte("\t")) {
+		l.report(pos, order, LintSyntax, "expected vertex or edge followed by a tab")
+		return
+	}
+	kind, data := parseLine(line)
+	if kind != "vertex" && kind != "edge" {
+		l.report(pos, order, LintSyntax, "unknown line type %q", kind)
+		return
+	}
+	obj, err := ParseJson(data)
+	if err != nil {
+		l.report(pos, order, LintSyntax, "bad JSON: %v", err)
+		return
+	}
+	l.label(pos, order, obj)
+	if kind == "vertex" {
+		l.vertex(pos, order, obj)
+	} else {
+		l.edge(pos, order, obj)
+	}
+}
+
+// key is the id in the namespace of the line obj of pos.
+func (l *Linter) key(pos lintPos, order int, obj JsonObject, field string) (key, id string, ok bool) {
+	id, err := jsonId(obj, field)
+	if err != nil {
+		l.report(pos, order, LintId, "%v", err)
+		return "", "", false
+	}
+	switch l.Namespace {
+	case "":
+		return id, id, true
+	case FileNamespace:
+		return pos.file + "\x00" + id, id, true
+	default:
+		ns, has := obj[l.Namespace]
+		if !has {
+			l.report(pos, order, LintId, "missing namespace attribute %q", l.Namespace)
+			return "", "", false
+		}
+		return fmt.Sprint(ns) + "\x00" + id, id, true
+	}
+}
+
+func (l *Linter) vertex(pos lintPos, order int, obj JsonObject) {
+	key, id, ok := l.key(pos, order, obj, "id")
+	if !ok {
+		return
+	}
+	if first, has := l.vertices[key]; has {
+		l.report(pos, order, LintDuplicateId, "duplicate vertex id %v (first defined on %v)", id, first.where(pos.file))
+		return
+	}
+	l.vertices[key] = pos
+}
+
+func (l *Linter) edge(pos lintPos, order int, obj JsonObject) {
+	src, srcId, ok := l.key(pos, order, obj, "src")
+	if !ok {
+		return
+	}
+	targ, targId, ok := l.key(pos, order, obj, "targ")
+	if !ok {
+		return
+	}
+	for _, end := range []lintEnd{{pos, order, src, srcId}, {pos, order, targ, targId}} {
+		if _, has := l.vertices[end.key]; !has {
+			l.pending = append(l.pending, end)
+		}
+		if src == targ {
+			break
+		}
+	}
+	if src == targ {
+		l.report(pos, order, LintSelfLoop, "edge from vertex %v to itself", srcId)
+	}
+	arc := [2]string{src, targ}
+	if l.Undirected && targ < src {
+		arc = [2]string{targ, src}
+	}
+	if first, has := l.arcs[arc]; has {
+		l.report(pos, order, LintMultiEdge, "another edge between %v and %v (first on %v)", srcId, targId, first.where(pos.file))
+	} else {
+		l.arcs[arc] = pos
+	}
+}
+
+func (l *Linter) label(pos lintPos, order int, obj JsonObject) {
+	o, has := obj["label"]
+	if !has {
+		l.report(pos, order, LintLabel, "missing label")
+		return
+	}
+	labels := []interface{}{o}
+	if array, is := o.([]interface{}); is {
+		if !l.MultiLabels {
+			l.report(pos, order, LintLabel, "the label is an array (see --multi-labels)")
+			return
+		}
+		labels = array
+	}
+	for _, label := range labels {
+		switch v := label.(type) {
+		case string:
+			if strings.TrimSpace(v) != v {
+				l.report(pos, order, LintLabelWhitespace, "the label %q has leading or trailing whitespace (it is trimmed)", v)
+			}
+		case json.Number, bool, nil:
+			s, _ := canonicalLabel(v)
+			l.report(pos, order, LintLabel, "the label %v is not a string (it is read as %q)", v, s)
+		default:
+			l.report(pos, order, LintLabel, "the label %v is not a string or number", v)
+		}
+	}
+}
+
+// Findings is everything found in the files linted ordered by file and
+// line. The edges to vertices which were never defined are only known
+// once every file has been linted.
+func (l *Linter) Findings() []*LintFinding {
+	for _, end := range l.pending {
+		if def, has := l.vertices[end.key]; has {
+			l.report(end.lintPos, end.order, LintEdgeBeforeVertex, "vertex %v is defined after the edge (on %v)", end.id, def.where(end.file))
+		} else {
+			l.report(end.lintPos, end.order, LintUndefinedVertex, "vertex %v is not defined", end.id)
+		}
+	}
+	l.pending = nil
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.order != b.order {
+			return a.order < b.order
+		}
+		return a.Line < b.Line
+	})
+	return l.findings
+}
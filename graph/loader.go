@@ -0,0 +1,663 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/data-structures/hashtable"
+	"github.com/timtadh/data-structures/types"
+	"github.com/timtadh/fs2/bptree"
+	"github.com/timtadh/goiso"
+)
+
+// FileNamespace is the Loader.Namespace which scopes vertex ids to the
+// file they were read from.
+const FileNamespace = "file"
+
+// FileAttr is the vertex attribute the Loader records the source file
+// in when ids are namespaced by file. It may also be used as the
+// SupportAttr to make each file its own transaction.
+const FileAttr = "input_file"
+
+type loadVertex struct {
+	id     int
+	label  string
+	origin int // index of the first copy of the vertex (see MultiLabels)
+}
+
+type loadEdge struct {
+	src, targ int // indices into Loader.vertices
+	label     string
+	data      []byte // the edge's attributes, nil unless kept in EdgeAttrs
+	origin    int    // index of the first arc loaded for the same input edge
+}
+
+// excludedVertex is a vertex left out of the graph by ExcludeVertices.
+type excludedVertex struct {
+	data  []byte
+	edges []JsonObject // the edges dropped with it
+}
+
+// A Loader builds a goiso.Graph from its input in a single pass.
+//
+// goiso.Graph holds pointers into its own edge slice so it has to be
+// allocated at its final size. LoadGraph gets around this by reading the
+// input twice. The Loader instead keeps the vertices and edges as they
+// arrive and only constructs the goiso.Graph once the input is exhausted.
+// This makes it possible to load from a pipe or stdin and means compressed
+// inputs are only decompressed once.
+//
+// Bad lines do not stop the Loader. Each one is recorded as a ParseError
+// until more than MaxErrors have been seen at which point loading is
+// aborted. A negative MaxErrors never aborts.
+//
+// If there is a SupportAttr each vertex's value of it (its transaction)
+// is put in the SupportAttrs. An edge between vertices of different
+// transactions is a bad line.
+//
+// By default vertex ids are global so every file given to the Loader must
+// use distinct ids. Setting Namespace to FileNamespace scopes the ids to
+// the file they were read from (and records that file in the vertex's
+// FileAttr). Setting it to any other value scopes the ids by the value of
+// that attribute which must then be on both the vertex and edge lines. A
+// vertex id seen twice in the same namespace is an error. An id is an
+// integer of any size or a string. A vertex whose id does not fit in an
+// int is given its index in the graph as its goiso id; the id it was
+// loaded with is still in its attributes.
+//
+// Vertices whose (final) label matches ExcludeVertices are left out of the
+// graph along with their edges, as are the edges matching ExcludeEdges.
+// The excluded vertices are still put in the NodeAttrs (numbered after the
+// vertices of the graph) marked with the ExcludedAttr and listing the
+// edges dropped with them in the ExcludedEdgesAttr. The edges excluded
+// between two vertices of the graph are listed in the ExcludedEdgesAttr of
+// (every copy of) their src vertex.
+//
+// If Undirected each edge is loaded as a pair of opposing arcs with the
+// same label (see mine.RandomWalkMiner.Undirected).
+//
+// If MultiLabels the label attributes may be arrays of alternative
+// labels. A vertex with several labels is loaded as one copy of the vertex
+// for each label and its edges connect every copy (Origins maps the copies
+// back to the vertex). An edge with several labels is loaded once for each
+// label (EdgeOrigins maps the arcs back to the edge).
+//
+// If EdgeAttrs is set the attributes of each edge in the graph are put in
+// it keyed (like the NodeAttrs) by the edge's index in the graph. Both arcs
+// of an undirected edge get the same attributes.
+type Loader struct {
+	SupportAttr     string
+	NodeAttrs       *bptree.BpTree
+	EdgeAttrs       *bptree.BpTree // may be nil
+	SupportAttrs    map[int]string
+	MaxErrors       int
+	Namespace       string
+	VertexLabel     *LabelExpr
+	EdgeLabel       *LabelExpr
+	Rewrite         *Rewriter    // may be nil
+	ExcludeVertices *LabelFilter // may be nil
+	ExcludeEdges    *LabelFilter // may be nil
+	Undirected      bool
+	MultiLabels     bool
+	Workers         int // number of goroutines decoding veg lines
+	vertices        []loadVertex
+	edges           []loadEdge
+	vids            types.Map // (namespaced) id ==> int (index into vertices or -1-index into excluded)
+	excluded        []excludedVertex
+	excludedEdges   map[int][]JsonObject // origin of src ==> the edges from it excluded by ExcludeEdges
+	dropped         int                  // number of edges excluded
+	directedGSpan   int                  // see DirectedGSpanEdges
+	multi           bool                 // a vertex has been copied
+	multiEdge       bool                 // an edge has been loaded with several labels
+	errors          ParseErrors
+}
+
+func NewLoader(supportAttr string, nodeAttrs *bptree.BpTree, supportAttrs map[int]string) *Loader {
+	return &Loader{
+		SupportAttr:   supportAttr,
+		NodeAttrs:     nodeAttrs,
+		SupportAttrs:  supportAttrs,
+		MaxErrors:     -1,
+		Workers:       runtime.GOMAXPROCS(0),
+		VertexLabel:   DefaultLabel,
+		EdgeLabel:     DefaultLabel,
+		vertices:      make([]loadVertex, 0, 1024),
+		edges:         make([]loadEdge, 0, 1024),
+		vids:          hashtable.NewLinearHash(),
+		excludedEdges: make(map[int][]JsonObject),
+	}
+}
+
+// LoadGraphStream loads a veg graph from reader reading it exactly once.
+func LoadGraphStream(reader io.Reader, supportAttr string, nodeAttrs *bptree.BpTree, supportAttrs map[int]string) (graph *goiso.Graph, err error) {
+	l := NewLoader(supportAttr, nodeAttrs, supportAttrs)
+	if err := l.Veg("", reader); err != nil {
+		return nil, err
+	}
+	return l.Graph()
+}
+
+// Veg reads the veg formatted lines from reader into the Loader. name is
+// used to identify the input in the errors. Bad lines are accumulated and
+// reported by Graph. An error is only returned if the input could not be
+// read or there were more than MaxErrors bad lines.
+//
+// If there are several Workers the JSON of the lines is decoded in
+// parallel (see vegParallel). The result is the same as loading the lines
+// one at a time.
+func (l *Loader) Veg(name string, reader io.Reader) error {
+	if l.Workers > 1 {
+		return l.vegParallel(name, reader)
+	}
+	return l.lines(name, reader, func(line []byte) error {
+		p := parseVegLine(line)
+		return l.vegLine(name, &p)
+	})
+}
+
+// lines calls process on every non-blank line of reader recording the
+// errors it returns as ParseErrors.
+func (l *Loader) lines(name string, reader io.Reader, process func(line []byte) error) error {
+	lineno := 0
+	var aborted error
+	err := ProcessLinesUntil(reader, func(line []byte) bool {
+		lineno++
+		if len(bytes.TrimSpace(line)) == 0 {
+			return true
+		}
+		if err := process(line); err != nil {
+			aborted = l.error(&ParseError{File: name, Line: lineno, Text: string(bytes.TrimSpace(line)), Err: err})
+		}
+		return aborted == nil
+	})
+	if err != nil {
+		return err
+	}
+	return aborted
+}
+
+func (l *Loader) error(err *ParseError) error {
+	l.errors = append(l.errors, err)
+	if l.MaxErrors >= 0 && len(l.errors) > l.MaxErrors {
+		return &TooManyErrors{Max: l.MaxErrors, Errors: l.errors}
+	}
+	return nil
+}
+
+// Excluded is the number of vertices and edges left out of the graph by
+// ExcludeVertices and ExcludeEdges.
+func (l *Loader) Excluded() (vertices, edges int) {
+	return len(l.excluded), l.dropped
+}
+
+// storeExcluded puts the excluded vertices into the NodeAttrs after the
+// vertices of the graph and adds the excluded edges to the attributes of
+// the vertices they are from.
+func (l *Loader) storeExcluded() error {
+	if l.NodeAttrs == nil {
+		return nil
+	}
+	if err := l.storeExcludedEdges(); err != nil {
+		return err
+	}
+	for i, ex := range l.excluded {
+		obj, err := ParseJson(ex.data)
+		if err != nil {
+			return err
+		}
+		obj[ExcludedAttr] = true
+		if len(ex.edges) > 0 {
+			obj[ExcludedEdgesAttr] = ex.edges
+		}
+		data, err := renderJson(obj)
+		if err != nil {
+			return err
+		}
+		bid := make([]byte, 4)
+		binary.BigEndian.PutUint32(bid, uint32(len(l.vertices)+i))
+		if err := l.NodeAttrs.Add(bid, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Loader) storeExcludedEdges() error {
+	origins := make([]int, 0, len(l.excludedEdges))
+	for origin := range l.excludedEdges {
+		origins = append(origins, origin)
+	}
+	sort.Ints(origins)
+	for _, origin := range origins {
+		for _, idx := range l.copies(origin) {
+			obj, err := TreeAttrs(l.NodeAttrs, idx)
+			if err != nil {
+				return err
+			} else if obj == nil {
+				obj = make(JsonObject)
+			}
+			obj[ExcludedEdgesAttr] = l.excludedEdges[origin]
+			data, err := renderJson(obj)
+			if err != nil {
+				return err
+			}
+			bid := make([]byte, 4)
+			binary.BigEndian.PutUint32(bid, uint32(idx))
+			err = l.NodeAttrs.Remove(bid, func([]byte) bool { return true })
+			if err != nil {
+				return err
+			}
+			if err := l.NodeAttrs.Add(bid, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Errors returns the bad lines seen so far.
+func (l *Loader) Errors() ParseErrors {
+	return l.errors
+}
+
+// vidString is the vertex id as it appeared in the input (without its
+// namespace).
+func vidString(vid types.Hashable) string {
+	switch v := vid.(type) {
+	case types.String:
+		s := string(v)
+		return s[strings.LastIndex(s, "\x00")+1:]
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// vid is the key for vertex id in the namespace the line obj (from file)
+// belongs to. Ids are compared as text so 7 and "7" are the same vertex.
+func (l *Loader) vid(file string, obj JsonObject, id string) (types.Hashable, error) {
+	switch l.Namespace {
+	case "":
+		return types.String(id), nil
+	case FileNamespace:
+		return vertexKey(file, id), nil
+	default:
+		ns, has := obj[l.Namespace]
+		if !has {
+			return nil, fmt.Errorf("missing namespace attribute %q", l.Namespace)
+		}
+		return vertexKey(fmt.Sprint(ns), id), nil
+	}
+}
+
+// vertex adds the vertex of the veg line data whose JSON is obj.
+func (l *Loader) vertex(file string, obj JsonObject, data []byte) (err error) {
+	_id, err := jsonId(obj, "id")
+	if err != nil {
+		return err
+	}
+	labels, rewritten, err := l.vertexLabels(obj, true)
+	if err != nil {
+		return err
+	}
+	vid, err := l.vid(file, obj, _id)
+	if err != nil {
+		return err
+	}
+	transaction, err := l.transaction(file, obj)
+	if err != nil {
+		return err
+	}
+	if l.NodeAttrs != nil && (rewritten || l.Namespace == FileNamespace) {
+		if l.Namespace == FileNamespace {
+			obj[FileAttr] = file
+		}
+		data, err = renderJson(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return l.addVertex(vid, l.vertexId(_id), labels, transaction, data)
+}
+
+// transaction is the value of the SupportAttr for the vertex obj from
+// file.
+func (l *Loader) transaction(file string, obj JsonObject) (string, error) {
+	if l.SupportAttr == FileAttr {
+		return file, nil
+	} else if l.SupportAttr != "" {
+		a, has := obj[l.SupportAttr]
+		if !has {
+			return "", fmt.Errorf("vertex did not have required supportAttr %v", l.SupportAttr)
+		}
+		return fmt.Sprint(a), nil
+	}
+	return "", nil
+}
+
+// labels evaluates expr against obj. There is more than one label only if
+// MultiLabels.
+func (l *Loader) labels(expr *LabelExpr, obj JsonObject, strict bool) ([]string, error) {
+	if l.MultiLabels {
+		return expr.Labels(obj, strict)
+	}
+	label, err := expr.Label(obj, strict)
+	if err != nil {
+		return nil, err
+	}
+	return []string{label}, nil
+}
+
+// labelValue is labels as an attribute value: a string unless there is
+// more than one.
+func labelValue(labels []string) interface{} {
+	if len(labels) == 1 {
+		return labels[0]
+	}
+	return labels
+}
+
+// rewrite trims labels and rewrites them with rewrite. If any were
+// rewritten obj (when not nil) is updated to record both the original and
+// rewritten labels.
+func (l *Loader) rewrite(obj JsonObject, labels []string, rewrite func(string) string) ([]string, bool) {
+	to := make([]string, 0, len(labels))
+	rewritten := false
+	for i := range labels {
+		labels[i] = strings.TrimSpace(labels[i])
+		label := labels[i]
+		if l.Rewrite != nil {
+			label = rewrite(label)
+		}
+		rewritten = rewritten || label != labels[i]
+		to = append(to, label)
+	}
+	if rewritten && obj != nil {
+		obj[OriginalLabelAttr] = labelValue(labels)
+		obj[RewrittenLabelAttr] = labelValue(to)
+	}
+	return distinct(to), rewritten
+}
+
+// vertexLabels builds the labels of the vertex obj with the VertexLabel
+// and then rewrites them. If a label was rewritten obj is updated to
+// record both the original and rewritten labels.
+func (l *Loader) vertexLabels(obj JsonObject, strict bool) (labels []string, rewritten bool, err error) {
+	labels, err = l.labels(l.VertexLabel, obj, strict)
+	if err != nil {
+		return nil, false, err
+	}
+	labels, rewritten = l.rewrite(obj, labels, func(label string) string {
+		return l.Rewrite.Vertex(label)
+	})
+	return labels, rewritten, nil
+}
+
+// vertexObj adds the vertex (read from file) with the attributes obj. It
+// is used by the formats which are not veg. Unlike veg these formats often
+// have unlabeled graphs so a missing label is the empty label.
+func (l *Loader) vertexObj(file string, vid types.Hashable, id int64, obj JsonObject) (err error) {
+	labels, _, err := l.vertexLabels(obj, false)
+	if err != nil {
+		return err
+	}
+	transaction, err := l.transaction(file, obj)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if l.NodeAttrs != nil {
+		if l.Namespace == FileNamespace {
+			obj[FileAttr] = file
+		}
+		data, err = renderJson(obj)
+		if err != nil {
+			return err
+		}
+	}
+	return l.addVertex(vid, id, labels, transaction, data)
+}
+
+// addVertex adds the vertex known as vid with a copy for each of its
+// (trimmed) labels. The transaction is only recorded if there is a
+// SupportAttr and data is what gets stored in the NodeAttrs.
+func (l *Loader) addVertex(vid types.Hashable, id int64, labels []string, transaction string, data []byte) error {
+	if l.vids.Has(vid) {
+		return fmt.Errorf("duplicate vertex id %v", vidString(vid))
+	}
+	kept := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if !l.ExcludeVertices.Match(label) {
+			kept = append(kept, label)
+		}
+	}
+	kept = distinct(kept)
+	if len(kept) == 0 {
+		l.excluded = append(l.excluded, excludedVertex{data: data})
+		return l.vids.Put(vid, -len(l.excluded))
+	}
+	origin := len(l.vertices)
+	err := l.vids.Put(vid, origin)
+	if err != nil {
+		return err
+	}
+	if len(kept) > 1 {
+		l.multi = true
+	}
+	for _, label := range kept {
+		idx := len(l.vertices)
+		l.vertices = append(l.vertices, loadVertex{id: int(id), label: label, origin: origin})
+		if l.SupportAttr != "" {
+			l.SupportAttrs[idx] = transaction
+		}
+		if l.NodeAttrs != nil {
+			bid := make([]byte, 4)
+			binary.BigEndian.PutUint32(bid, uint32(idx))
+			err = l.NodeAttrs.Add(bid, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copies is the indices of the copies of the vertex whose first copy is
+// at origin.
+func (l *Loader) copies(origin int) []int {
+	idxs := []int{origin}
+	for i := origin + 1; i < len(l.vertices) && l.vertices[i].origin == origin; i++ {
+		idxs = append(idxs, i)
+	}
+	return idxs
+}
+
+// Origins maps each vertex of the graph to the index of the first copy of
+// the vertex it is a copy of (see MultiLabels). It is nil if there were no
+// copies.
+func (l *Loader) Origins() []int {
+	if !l.multi {
+		return nil
+	}
+	origins := make([]int, len(l.vertices))
+	for i, v := range l.vertices {
+		origins[i] = v.origin
+	}
+	return origins
+}
+
+// EdgeOrigins maps each edge of the graph to the index of the first arc
+// loaded for the same input edge. An edge with several labels (see
+// MultiLabels) is loaded as an arc for each label and an embedding may
+// only use one of them. It is nil if no edge had several labels.
+func (l *Loader) EdgeOrigins() []int {
+	if !l.multiEdge {
+		return nil
+	}
+	origins := make([]int, len(l.edges))
+	for i, e := range l.edges {
+		origins[i] = e.origin
+	}
+	return origins
+}
+
+// edge adds the edge of the veg line whose JSON is obj.
+func (l *Loader) edge(file string, obj JsonObject) (err error) {
+	_src, err := jsonId(obj, "src")
+	if err != nil {
+		return err
+	}
+	_targ, err := jsonId(obj, "targ")
+	if err != nil {
+		return err
+	}
+	labels, err := l.labels(l.EdgeLabel, obj, true)
+	if err != nil {
+		return err
+	}
+	srcId, err := l.vid(file, obj, _src)
+	if err != nil {
+		return err
+	}
+	targId, err := l.vid(file, obj, _targ)
+	if err != nil {
+		return err
+	}
+	return l.addEdge(srcId, targId, labels, obj)
+}
+
+// addEdge adds an edge for each label between (every copy of) the
+// vertices known as srcId and targId. obj holds the edge's attributes and
+// may be nil.
+func (l *Loader) addEdge(srcId, targId types.Hashable, labels []string, obj JsonObject) error {
+	u, err := l.vids.Get(srcId)
+	if err != nil {
+		return fmt.Errorf("edge src %v is not a known vertex", vidString(srcId))
+	}
+	v, err := l.vids.Get(targId)
+	if err != nil {
+		return fmt.Errorf("edge targ %v is not a known vertex", vidString(targId))
+	}
+	labels, _ = l.rewrite(obj, labels, func(label string) string {
+		return l.Rewrite.Edge(label)
+	})
+	kept := make([]string, 0, len(labels))
+	excluded := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if !l.ExcludeEdges.Match(label) {
+			kept = append(kept, label)
+		} else {
+			excluded = append(excluded, label)
+		}
+	}
+	src, targ := u.(int), v.(int)
+	if l.SupportAttr != "" && src >= 0 && targ >= 0 && l.SupportAttrs[src] != l.SupportAttrs[targ] {
+		return fmt.Errorf("edge from %v to %v crosses from transaction %q to %q",
+			vidString(srcId), vidString(targId), l.SupportAttrs[src], l.SupportAttrs[targ])
+	}
+	if src >= 0 && targ >= 0 && len(excluded) > 0 {
+		l.excludedEdges[src] = append(l.excludedEdges[src], JsonObject{
+			"src":   vidString(srcId),
+			"targ":  vidString(targId),
+			"label": labelValue(excluded),
+		})
+	}
+	if src < 0 || targ < 0 || len(kept) == 0 {
+		l.dropped++
+		for _, x := range []int{src, targ} {
+			if x < 0 {
+				ex := &l.excluded[-x-1]
+				ex.edges = append(ex.edges, JsonObject{
+					"src":   vidString(srcId),
+					"targ":  vidString(targId),
+					"label": labelValue(labels),
+				})
+			}
+		}
+		return nil
+	}
+	var data []byte
+	if l.EdgeAttrs != nil && obj != nil {
+		data, err = renderJson(obj)
+		if err != nil {
+			return err
+		}
+	}
+	if len(kept) > 1 {
+		l.multiEdge = true
+	}
+	origin := len(l.edges)
+	for _, s := range l.copies(src) {
+		for _, t := range l.copies(targ) {
+			if src == targ && s != t {
+				// a self loop stays on each copy
+				continue
+			}
+			for _, label := range kept {
+				l.edges = append(l.edges, loadEdge{src: s, targ: t, label: label, data: data, origin: origin})
+				if l.Undirected && s != t {
+					l.edges = append(l.edges, loadEdge{src: t, targ: s, label: label, data: data, origin: origin})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Graph constructs the goiso.Graph from everything loaded so far. The
+// graph is returned even if there were errors.
+func (l *Loader) Graph() (graph *goiso.Graph, err error) {
+	G := goiso.NewGraph(len(l.vertices), len(l.edges))
+	graph = &G
+	vertices := make([]*goiso.Vertex, 0, len(l.vertices))
+	for _, v := range l.vertices {
+		vertices = append(vertices, graph.AddVertex(v.id, v.label))
+	}
+	for _, e := range l.edges {
+		edge := graph.AddEdge(vertices[e.src], vertices[e.targ], e.label)
+		if l.EdgeAttrs != nil && e.data != nil {
+			bid := make([]byte, 4)
+			binary.BigEndian.PutUint32(bid, uint32(edge.Idx))
+			if err := l.EdgeAttrs.Add(bid, e.data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := l.storeExcluded(); err != nil {
+		return nil, err
+	}
+	if len(l.errors) == 0 {
+		return graph, nil
+	}
+	return graph, l.errors
+}
@@ -0,0 +1,154 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The attributes recorded on a vertex whose label was rewritten.
+const (
+	OriginalLabelAttr  = "original_label"
+	RewrittenLabelAttr = "rewritten_label"
+)
+
+type RewriteRule struct {
+	Vertices bool
+	Edges    bool
+	Regex    *regexp.Regexp // nil for a mapping
+	From     string
+	To       string
+}
+
+func (r *RewriteRule) apply(label string) string {
+	if r.Regex != nil {
+		return r.Regex.ReplaceAllString(label, r.To)
+	} else if label == r.From {
+		return r.To
+	}
+	return label
+}
+
+// A Rewriter rewrites the labels as the graph is loaded so for instance
+// several labels can be collapsed into one equivalence class. The rules
+// are applied in order each one to the output of the previous.
+type Rewriter struct {
+	Rules []*RewriteRule
+}
+
+// LoadRewriter reads the rules file. Each line is a rule
+//
+//	<vertex|edge|label> <re|map> <pattern> => <replacement>
+//
+// A "label" rule applies to both vertices and edges. A "re" rule replaces
+// the matches of the regular expression <pattern> with <replacement>
+// (which may refer to groups as $1). A "map" rule replaces a label which
+// is exactly <pattern>. Blank lines and lines starting with # are ignored.
+func LoadRewriter(reader io.Reader) (*Rewriter, error) {
+	var errors ParseErrors
+	r := &Rewriter{}
+	lineno := 0
+	err := ProcessLinesUntil(reader, func(line []byte) bool {
+		lineno++
+		text := strings.TrimSpace(string(line))
+		if text == "" || strings.HasPrefix(text, "#") {
+			return true
+		}
+		rule, err := parseRewriteRule(text)
+		if err != nil {
+			errors = append(errors, &ParseError{Line: lineno, Text: text, Err: err})
+		} else {
+			r.Rules = append(r.Rules, rule)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	} else if len(errors) > 0 {
+		return nil, errors
+	}
+	return r, nil
+}
+
+func parseRewriteRule(text string) (*RewriteRule, error) {
+	fields := strings.SplitN(text, " ", 3)
+	for len(fields) == 3 && fields[1] == "" {
+		fields = strings.SplitN(fields[0]+" "+strings.TrimLeft(fields[2], " "), " ", 3)
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected: <vertex|edge|label> <re|map> <pattern> => <replacement>")
+	}
+	rule := &RewriteRule{}
+	switch fields[0] {
+	case "vertex":
+		rule.Vertices = true
+	case "edge":
+		rule.Edges = true
+	case "label":
+		rule.Vertices = true
+		rule.Edges = true
+	default:
+		return nil, fmt.Errorf("rule must be for a vertex, edge or label not %q", fields[0])
+	}
+	parts := strings.SplitN(fields[2], "=>", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rule is missing =>")
+	}
+	from := strings.TrimSpace(parts[0])
+	rule.To = strings.TrimSpace(parts[1])
+	switch fields[1] {
+	case "re":
+		re, err := regexp.Compile(from)
+		if err != nil {
+			return nil, err
+		}
+		rule.Regex = re
+	case "map":
+		rule.From = from
+	default:
+		return nil, fmt.Errorf("rule kind must be re or map not %q", fields[1])
+	}
+	return rule, nil
+}
+
+func (r *Rewriter) Vertex(label string) string {
+	for _, rule := range r.Rules {
+		if rule.Vertices {
+			label = rule.apply(label)
+		}
+	}
+	return label
+}
+
+func (r *Rewriter) Edge(label string) string {
+	for _, rule := range r.Rules {
+		if rule.Edges {
+			label = rule.apply(label)
+		}
+	}
+	return label
+}
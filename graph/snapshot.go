@@ -0,0 +1,354 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"syscall"
+)
+
+import (
+	"github.com/timtadh/fs2/bptree"
+	"github.com/timtadh/goiso"
+)
+
+// A snapshot is a loaded graph saved in a compact binary form so it can
+// be reloaded without parsing the input again. The layout is
+//
+//	magic, version, hash
+//	colors:       count, (len, label)*
+//	vertices:     count, (id int64, color)*
+//	edges:        count, (src, targ, color)*
+//	support:      count, (vertex idx, len, attr)*
+//	origins:      count, (vertex idx)*
+//	edge origins: count, (edge idx)*
+//	attrs:        count, (len, key, len, value)*
+//	edge attrs:   count, (len, key, len, value)*
+//
+// where every integer not marked otherwise is a big endian uint32. The
+// attrs are the contents of the node and edge attribute trees.
+const (
+	snapshotMagic   = "graple snapshot\x00"
+	snapshotVersion = 4
+)
+
+// ErrStaleSnapshot is returned by ReadSnapshot when the snapshot was made
+// from a different input.
+var ErrStaleSnapshot = fmt.Errorf("the snapshot is stale")
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (s *snapshotWriter) u32(i int) {
+	if s.err != nil {
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(i))
+	_, s.err = s.w.Write(b[:])
+}
+
+func (s *snapshotWriter) u64(i int64) {
+	if s.err != nil {
+		return
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(i))
+	_, s.err = s.w.Write(b[:])
+}
+
+func (s *snapshotWriter) bytes(b []byte) {
+	s.u32(len(b))
+	if s.err != nil {
+		return
+	}
+	_, s.err = s.w.Write(b)
+}
+
+func (s *snapshotWriter) tree(bpt *bptree.BpTree) {
+	if bpt == nil {
+		s.u32(0)
+		return
+	}
+	s.u32(bpt.Size())
+	kvi, err := bpt.Iterate()
+	if err != nil {
+		s.err = err
+		return
+	}
+	for key, value, err, kvi := kvi(); kvi != nil; key, value, err, kvi = kvi() {
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.bytes(key)
+		s.bytes(value)
+	}
+}
+
+// WriteSnapshot writes g, the support attributes and origins (see
+// Loader.Origins) of its vertices, the origins of its edges (see
+// Loader.EdgeOrigins) and the contents of nodeAttrs and
+// edgeAttrs (either may be nil) to w. hash identifies the input the graph
+// was loaded from.
+func WriteSnapshot(w io.Writer, hash []byte, g *goiso.Graph, supportAttrs map[int]string, origins, edgeOrigins []int, nodeAttrs, edgeAttrs *bptree.BpTree) error {
+	s := &snapshotWriter{w: bufio.NewWriter(w)}
+	_, s.err = s.w.WriteString(snapshotMagic)
+	s.u32(snapshotVersion)
+	s.bytes(hash)
+	s.u32(len(g.Colors))
+	for _, label := range g.Colors {
+		s.bytes([]byte(label))
+	}
+	s.u32(len(g.V))
+	for _, v := range g.V {
+		s.u64(int64(v.Id))
+		s.u32(v.Color)
+	}
+	s.u32(len(g.E))
+	for _, e := range g.E {
+		s.u32(e.Src)
+		s.u32(e.Targ)
+		s.u32(e.Color)
+	}
+	idxs := make([]int, 0, len(supportAttrs))
+	for idx := range supportAttrs {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	s.u32(len(idxs))
+	for _, idx := range idxs {
+		s.u32(idx)
+		s.bytes([]byte(supportAttrs[idx]))
+	}
+	s.u32(len(origins))
+	for _, origin := range origins {
+		s.u32(origin)
+	}
+	s.u32(len(edgeOrigins))
+	for _, origin := range edgeOrigins {
+		s.u32(origin)
+	}
+	s.tree(nodeAttrs)
+	s.tree(edgeAttrs)
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+type snapshotReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (s *snapshotReader) next(n int) []byte {
+	if s.err != nil {
+		return nil
+	}
+	if n < 0 || s.off+n > len(s.data) {
+		s.err = fmt.Errorf("the snapshot is truncated")
+		return nil
+	}
+	b := s.data[s.off : s.off+n]
+	s.off += n
+	return b
+}
+
+func (s *snapshotReader) u32() int {
+	b := s.next(4)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+func (s *snapshotReader) u64() int64 {
+	b := s.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (s *snapshotReader) bytes() []byte {
+	return s.next(s.u32())
+}
+
+// count reads the number of entries of a section whose entries are at
+// least size bytes. A count the rest of the snapshot can not hold is an
+// error (and 0) so a corrupt count is not used to allocate.
+func (s *snapshotReader) count(size int) int {
+	n := s.u32()
+	if s.err != nil {
+		return 0
+	}
+	if int64(n)*int64(size) > int64(len(s.data)-s.off) {
+		s.err = fmt.Errorf("the snapshot is truncated")
+		return 0
+	}
+	return n
+}
+
+// index reads a vertex index which must be less than V.
+func (s *snapshotReader) index(V int) int {
+	idx := s.u32()
+	if idx >= V && s.err == nil {
+		s.err = fmt.Errorf("the snapshot refers to a missing vertex %d", idx)
+	}
+	return idx
+}
+
+// tree adds the entries of a tree to bpt (if it is not nil). With a nil
+// bpt it only checks the entries are all there.
+func (s *snapshotReader) tree(bpt *bptree.BpTree) {
+	n := s.count(8)
+	for i := 0; i < n && s.err == nil; i++ {
+		key := s.bytes()
+		value := s.bytes()
+		if bpt != nil && s.err == nil {
+			s.err = bpt.Add(key, value)
+		}
+	}
+}
+
+// ReadSnapshot memory maps the snapshot at path and rebuilds the graph it
+// holds along with its vertex and edge origins. The support attributes are put in
+// supportAttrs and the node and edge attributes added to nodeAttrs and
+// edgeAttrs (any of which may be nil). If the snapshot was not made from
+// an input with the given hash ErrStaleSnapshot is returned. A truncated
+// or corrupt snapshot is an error and nothing is added to the trees.
+func ReadSnapshot(path string, hash []byte, nodeAttrs, edgeAttrs *bptree.BpTree, supportAttrs map[int]string) (g *goiso.Graph, origins, edgeOrigins []int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if stat.Size() < int64(len(snapshotMagic)) {
+		return nil, nil, nil, fmt.Errorf("%v is not a snapshot", path)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer syscall.Munmap(data)
+	s := &snapshotReader{data: data}
+	if string(s.next(len(snapshotMagic))) != snapshotMagic {
+		return nil, nil, nil, fmt.Errorf("%v is not a snapshot", path)
+	}
+	if version := s.u32(); version != snapshotVersion {
+		return nil, nil, nil, fmt.Errorf("%v has snapshot version %d expected %d", path, version, snapshotVersion)
+	}
+	if !bytes.Equal(s.bytes(), hash) {
+		return nil, nil, nil, ErrStaleSnapshot
+	}
+	colors := make([]string, s.count(4))
+	for i := range colors {
+		colors[i] = string(s.bytes())
+	}
+	color := func() string {
+		c := s.u32()
+		if c >= len(colors) {
+			if s.err == nil {
+				s.err = fmt.Errorf("the snapshot has a bad label %d", c)
+			}
+			return ""
+		}
+		return colors[c]
+	}
+	V := s.count(12)
+	type vertex struct {
+		id    int64
+		label string
+	}
+	vertices := make([]vertex, 0, V)
+	for i := 0; i < V && s.err == nil; i++ {
+		id := s.u64()
+		vertices = append(vertices, vertex{id, color()})
+	}
+	E := s.count(12)
+	if s.err != nil {
+		return nil, nil, nil, s.err
+	}
+	G := goiso.NewGraph(V, E)
+	g = &G
+	for _, v := range vertices {
+		g.AddVertex(int(v.id), v.label)
+	}
+	for i := 0; i < E && s.err == nil; i++ {
+		src := s.index(V)
+		targ := s.index(V)
+		label := color()
+		if s.err == nil {
+			g.AddEdge(&g.V[src], &g.V[targ], label)
+		}
+	}
+	n := s.count(8)
+	for i := 0; i < n && s.err == nil; i++ {
+		idx := s.index(V)
+		attr := string(s.bytes())
+		if supportAttrs != nil {
+			supportAttrs[idx] = attr
+		}
+	}
+	if n = s.count(4); n > 0 {
+		origins = make([]int, 0, n)
+	}
+	for i := 0; i < n && s.err == nil; i++ {
+		origins = append(origins, s.index(V))
+	}
+	if n = s.count(4); n > 0 {
+		edgeOrigins = make([]int, 0, n)
+	}
+	for i := 0; i < n && s.err == nil; i++ {
+		edgeOrigins = append(edgeOrigins, s.index(E))
+	}
+	// check the trees are intact before adding them
+	trees := s.off
+	s.tree(nil)
+	s.tree(nil)
+	if s.err != nil {
+		return nil, nil, nil, s.err
+	}
+	s.off = trees
+	s.tree(nodeAttrs)
+	s.tree(edgeAttrs)
+	if s.err != nil {
+		return nil, nil, nil, s.err
+	}
+	return g, origins, edgeOrigins, nil
+}
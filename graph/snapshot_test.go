@@ -0,0 +1,141 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+import (
+	"github.com/timtadh/goiso"
+)
+
+func testSnapshotGraph() *goiso.Graph {
+	G := goiso.NewGraph(4, 4)
+	g := &G
+	a := g.AddVertex(1, "a")
+	b := g.AddVertex(2, "b")
+	c := g.AddVertex(1<<40, "a")
+	d := g.AddVertex(7, "c")
+	g.AddEdge(a, b, "x")
+	g.AddEdge(b, c, "y")
+	g.AddEdge(c, a, "x")
+	g.AddEdge(d, d, "z")
+	return g
+}
+
+func writeTestSnapshot(t *testing.T, dir string, data []byte) string {
+	path := filepath.Join(dir, "snapshot")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graple-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g := testSnapshotGraph()
+	hash := []byte("the input hash")
+	transactions := map[int]string{0: "t1", 1: "t1", 2: "t2", 3: "t2"}
+	origins := []int{0, 1, 0, 3}
+	edgeOrigins := []int{0, 1, 1, 3}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, hash, g, transactions, origins, edgeOrigins, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestSnapshot(t, dir, buf.Bytes())
+
+	readTransactions := make(map[int]string)
+	G, readOrigins, readEdgeOrigins, err := ReadSnapshot(path, hash, nil, nil, readTransactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.V, G.V) {
+		t.Errorf("the vertices differ %v != %v", g.V, G.V)
+	}
+	if !reflect.DeepEqual(g.E, G.E) {
+		t.Errorf("the edges differ %v != %v", g.E, G.E)
+	}
+	if !reflect.DeepEqual(g.Colors, G.Colors) {
+		t.Errorf("the colors differ %v != %v", g.Colors, G.Colors)
+	}
+	if !reflect.DeepEqual(transactions, readTransactions) {
+		t.Errorf("the transactions differ %v != %v", transactions, readTransactions)
+	}
+	if !reflect.DeepEqual(origins, readOrigins) {
+		t.Errorf("the origins differ %v != %v", origins, readOrigins)
+	}
+	if !reflect.DeepEqual(edgeOrigins, readEdgeOrigins) {
+		t.Errorf("the edge origins differ %v != %v", edgeOrigins, readEdgeOrigins)
+	}
+
+	if _, _, _, err := ReadSnapshot(path, []byte("another hash"), nil, nil, nil); err != ErrStaleSnapshot {
+		t.Errorf("expected ErrStaleSnapshot got %v", err)
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graple-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hash := []byte("hash")
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, hash, testSnapshotGraph(), nil, []int{0, 1, 2, 3}, []int{0, 1, 2, 3}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// the trees are empty and so end in two zero counts
+	for n := len(data) - 8; n > len(snapshotMagic); n-- {
+		path := writeTestSnapshot(t, dir, data[:n])
+		if _, _, _, err := ReadSnapshot(path, hash, nil, nil, nil); err == nil {
+			t.Fatalf("read a snapshot truncated to %d of %d bytes", n, len(data))
+		}
+	}
+	// the vertex count follows the magic, version, hash and colors
+	off := len(snapshotMagic) + 4 + 4 + len(hash) + 4
+	for _, label := range testSnapshotGraph().Colors {
+		off += 4 + len(label)
+	}
+	if n := binary.BigEndian.Uint32(data[off:]); n != 4 {
+		t.Fatalf("expected the vertex count at %d found %d", off, n)
+	}
+	corrupt := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(corrupt[off:], 0xffffffff)
+	path := writeTestSnapshot(t, dir, corrupt)
+	if _, _, _, err := ReadSnapshot(path, hash, nil, nil, nil); err == nil {
+		t.Fatal("read a snapshot with a corrupt vertex count")
+	}
+}
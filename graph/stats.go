@@ -0,0 +1,227 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+import (
+	"github.com/timtadh/goiso"
+)
+
+type LabelCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// TripleCount is the number of edges with a label between vertices with
+// the Src and Targ labels.
+type TripleCount struct {
+	Src   string `json:"src"`
+	Edge  string `json:"edge"`
+	Targ  string `json:"targ"`
+	Count int    `json:"count"`
+}
+
+// SizeCount is the number of things (vertices or components) of a Size.
+type SizeCount struct {
+	Size  int `json:"size"`
+	Count int `json:"count"`
+}
+
+// Stats summarizes a graph to help pick the support and minimum size to
+// mine it with.
+type Stats struct {
+	Vertices      int           `json:"vertices"`
+	Edges         int           `json:"edges"`
+	NVertexLabels int           `json:"distinct_vertex_labels"`
+	NEdgeLabels   int           `json:"distinct_edge_labels"`
+	VertexLabels  []LabelCount  `json:"vertex_labels"`
+	EdgeLabels    []LabelCount  `json:"edge_labels"`
+	Triples       []TripleCount `json:"triples"`
+	Degrees       []SizeCount   `json:"degrees"`
+	Components    []SizeCount   `json:"components"`
+	Largest       int           `json:"largest_component"`
+	// What survives pruning by label frequency at Support (when > 0).
+	Support           int `json:"support"`
+	SupportedVertices int `json:"supported_vertices"`
+	SupportedEdges    int `json:"supported_edges"`
+	SupportedLabels   int `json:"supported_labels"`
+}
+
+func sortedLabels(counts map[string]int, top int) []LabelCount {
+	labels := make([]LabelCount, 0, len(counts))
+	for label, count := range counts {
+		labels = append(labels, LabelCount{label, count})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Count != labels[j].Count {
+			return labels[i].Count > labels[j].Count
+		}
+		return labels[i].Label < labels[j].Label
+	})
+	if top > 0 && len(labels) > top {
+		labels = labels[:top]
+	}
+	return labels
+}
+
+func sortedSizes(counts map[int]int) []SizeCount {
+	sizes := make([]SizeCount, 0, len(counts))
+	for size, count := range counts {
+		sizes = append(sizes, SizeCount{size, count})
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].Size < sizes[j].Size })
+	return sizes
+}
+
+// ComputeStats summarizes g keeping the top most frequent labels and
+// triples (all of them if top <= 0). If undirected each pair of opposing
+// arcs is counted as one edge.
+//
+// If support > 0 it estimates how much of the graph can be mined at that
+// support: a label is kept when it is on at least support vertices and
+// edges and an edge when it and both its vertices have kept labels. This
+// is only an estimate. The miner does not prune the graph up front, it
+// skips the infrequent edges as it extends the embeddings, and it counts
+// both arcs of an undirected edge.
+func ComputeStats(g *goiso.Graph, support, top int, undirected bool) *Stats {
+	edges := NewExport(g, nil, undirected).Edges
+	s := &Stats{Vertices: len(g.V), Edges: len(edges), Support: support}
+	vlabels := make(map[string]int)
+	degree := make([]int, len(g.V))
+	for i := range g.V {
+		vlabels[g.Colors[g.V[i].Color]]++
+	}
+	elabels := make(map[string]int)
+	type triple struct{ src, edge, targ int }
+	triples := make(map[triple]int)
+	for _, i := range edges {
+		e := &g.E[i]
+		elabels[g.Colors[e.Color]]++
+		triples[triple{g.V[e.Src].Color, e.Color, g.V[e.Targ].Color}]++
+		degree[e.Src]++
+		degree[e.Targ]++
+	}
+	s.NVertexLabels = len(vlabels)
+	s.NEdgeLabels = len(elabels)
+	s.VertexLabels = sortedLabels(vlabels, top)
+	s.EdgeLabels = sortedLabels(elabels, top)
+	for t, count := range triples {
+		s.Triples = append(s.Triples, TripleCount{g.Colors[t.src], g.Colors[t.edge], g.Colors[t.targ], count})
+	}
+	sort.Slice(s.Triples, func(i, j int) bool {
+		a, b := s.Triples[i], s.Triples[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Src != b.Src {
+			return a.Src < b.Src
+		} else if a.Edge != b.Edge {
+			return a.Edge < b.Edge
+		}
+		return a.Targ < b.Targ
+	})
+	if top > 0 && len(s.Triples) > top {
+		s.Triples = s.Triples[:top]
+	}
+	degrees := make(map[int]int)
+	for _, d := range degree {
+		degrees[d]++
+	}
+	s.Degrees = sortedSizes(degrees)
+	_, sizes := ConnectedComponents(g, nil)
+	components := make(map[int]int)
+	for _, size := range sizes {
+		components[size]++
+	}
+	s.Components = sortedSizes(components)
+	if len(sizes) > 0 {
+		s.Largest = sizes[0]
+	}
+	if support > 0 {
+		supported := func(color int) bool {
+			label := g.Colors[color]
+			return vlabels[label]+elabels[label] >= support
+		}
+		for c := range g.Colors {
+			if supported(c) {
+				s.SupportedLabels++
+			}
+		}
+		for i := range g.V {
+			if supported(g.V[i].Color) {
+				s.SupportedVertices++
+			}
+		}
+		for _, i := range edges {
+			e := &g.E[i]
+			if supported(e.Color) && supported(g.V[e.Src].Color) && supported(g.V[e.Targ].Color) {
+				s.SupportedEdges++
+			}
+		}
+	}
+	return s
+}
+
+// WriteTable writes the stats as human readable tables.
+func (s *Stats) WriteTable(w io.Writer) error {
+	t := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(t, "vertices\t%d\n", s.Vertices)
+	fmt.Fprintf(t, "edges\t%d\n", s.Edges)
+	fmt.Fprintf(t, "vertex labels\t%d\n", s.NVertexLabels)
+	fmt.Fprintf(t, "edge labels\t%d\n", s.NEdgeLabels)
+	fmt.Fprintf(t, "largest component\t%d\n", s.Largest)
+	if s.Support > 0 {
+		fmt.Fprintf(t, "\nat support %d\n", s.Support)
+		fmt.Fprintf(t, "labels\t%d\n", s.SupportedLabels)
+		fmt.Fprintf(t, "vertices\t%d\n", s.SupportedVertices)
+		fmt.Fprintf(t, "edges\t%d\n", s.SupportedEdges)
+	}
+	labels := func(title string, labels []LabelCount) {
+		fmt.Fprintf(t, "\n%s\tcount\n", title)
+		for _, l := range labels {
+			fmt.Fprintf(t, "%q\t%d\n", l.Label, l.Count)
+		}
+	}
+	labels("vertex label", s.VertexLabels)
+	labels("edge label", s.EdgeLabels)
+	fmt.Fprintf(t, "\nsrc label\tedge label\ttarg label\tcount\n")
+	for _, tr := range s.Triples {
+		fmt.Fprintf(t, "%q\t%q\t%q\t%d\n", tr.Src, tr.Edge, tr.Targ, tr.Count)
+	}
+	sizes := func(title, unit string, sizes []SizeCount) {
+		fmt.Fprintf(t, "\n%s\t%s\n", title, unit)
+		for _, sc := range sizes {
+			fmt.Fprintf(t, "%d\t%d\n", sc.Size, sc.Count)
+		}
+	}
+	sizes("degree", "vertices", s.Degrees)
+	sizes("component size", "components", s.Components)
+	return t.Flush()
+}
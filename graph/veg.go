@@ -0,0 +1,157 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// vegBatchSize is the number of lines a Veg worker decodes at a time.
+const vegBatchSize = 512
+
+// vegLine is a decoded veg line. A line without a kind (blank or without
+// a tab) is skipped.
+type vegLine struct {
+	kind string
+	data []byte
+	obj  JsonObject
+	err  error
+}
+
+// vegBatch is a run of consecutive lines. done is closed once a worker
+// has decoded them into parsed.
+type vegBatch struct {
+	lineno int // of the first line
+	lines  [][]byte
+	parsed []vegLine
+	done   chan struct{}
+}
+
+func parseVegLine(line []byte) (p vegLine) {
+	if !bytes.Contains(line, []byte("\t")) {
+		return p
+	}
+	p.kind, p.data = parseLine(line)
+	switch p.kind {
+	case "vertex", "edge":
+		p.obj, p.err = ParseJson(p.data)
+	default:
+		p.err = fmt.Errorf("Unknown line type %v", p.kind)
+	}
+	return p
+}
+
+// vegLine adds the vertex or edge of the decoded line p.
+func (l *Loader) vegLine(name string, p *vegLine) error {
+	if p.err != nil {
+		return p.err
+	}
+	switch p.kind {
+	case "vertex":
+		return l.vertex(name, p.obj, p.data)
+	case "edge":
+		return l.edge(name, p.obj)
+	}
+	return nil
+}
+
+// vegParallel is Veg with the lines decoded by a pool of Workers. One
+// goroutine splits the input into batches of lines which are handed to
+// the workers and (in the same order) to the calling goroutine. It waits
+// for each batch to be decoded and then adds its vertices and edges so
+// they are added in the order of the input.
+func (l *Loader) vegParallel(name string, reader io.Reader) error {
+	work := make(chan *vegBatch, l.Workers)
+	ordered := make(chan *vegBatch, 2*l.Workers)
+	stop := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(ordered)
+		defer close(work)
+		batch := &vegBatch{lineno: 1, done: make(chan struct{})}
+		stopped := false
+		send := func() bool {
+			select {
+			case work <- batch:
+			case <-stop:
+				stopped = true
+				return false
+			}
+			select {
+			case ordered <- batch:
+			case <-stop:
+				stopped = true
+				return false
+			}
+			batch = &vegBatch{lineno: batch.lineno + len(batch.lines), done: make(chan struct{})}
+			return true
+		}
+		readErr = ProcessLinesUntil(reader, func(line []byte) bool {
+			batch.lines = append(batch.lines, line)
+			if len(batch.lines) < vegBatchSize {
+				return true
+			}
+			return send()
+		})
+		// after a stop batch may already be with a worker
+		if readErr == nil && !stopped && len(batch.lines) > 0 {
+			send()
+		}
+	}()
+	for i := 0; i < l.Workers; i++ {
+		go func() {
+			for b := range work {
+				b.parsed = make([]vegLine, len(b.lines))
+				for j, line := range b.lines {
+					if len(bytes.TrimSpace(line)) > 0 {
+						b.parsed[j] = parseVegLine(line)
+					}
+				}
+				close(b.done)
+			}
+		}()
+	}
+	var aborted error
+	for b := range ordered {
+		if aborted != nil {
+			continue
+		}
+		<-b.done
+		for j := range b.parsed {
+			if err := l.vegLine(name, &b.parsed[j]); err != nil {
+				aborted = l.error(&ParseError{File: name, Line: b.lineno + j, Text: string(bytes.TrimSpace(b.lines[j])), Err: err})
+				if aborted != nil {
+					close(stop)
+					break
+				}
+			}
+		}
+	}
+	if aborted != nil {
+		return aborted
+	}
+	return readErr
+}
@@ -0,0 +1,167 @@
+package graph
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/timtadh/goiso"
+)
+
+// testVeg is a veg graph spanning several batches with a bad line at each
+// of the bad line numbers.
+func testVeg(vertices int, bad map[int]bool) []byte {
+	var buf bytes.Buffer
+	lineno := 0
+	line := func(kind, format string, args ...interface{}) {
+		lineno++
+		if bad[lineno] {
+			fmt.Fprintf(&buf, "vertex\t{\"id\": \"oops\"\n")
+			lineno++
+		}
+		fmt.Fprintf(&buf, kind+"\t"+format+"\n", args...)
+	}
+	for i := 0; i < vertices; i++ {
+		line("vertex", `{"id": %d, "label": "v%d"}`, i, i%7)
+		if i > 0 {
+			line("edge", `{"src": %d, "targ": %d, "label": "e%d"}`, i-1, i, i%3)
+		}
+		if i > 1 && i%5 == 0 {
+			line("edge", `{"src": %d, "targ": %d, "label": "back"}`, i, i-2)
+		}
+	}
+	return buf.Bytes()
+}
+
+func loadTestVeg(t *testing.T, input []byte, workers, maxErrors int) (*goiso.Graph, error, []int) {
+	l := NewLoader("", nil, nil)
+	l.Workers = workers
+	l.MaxErrors = maxErrors
+	vegErr := l.Veg("test.veg", bytes.NewReader(input))
+	G, _ := l.Graph()
+	lines := make([]int, 0, len(l.Errors()))
+	for _, err := range l.Errors() {
+		lines = append(lines, err.(*ParseError).Line)
+	}
+	return G, vegErr, lines
+}
+
+func assertSameGraph(t *testing.T, a, b *goiso.Graph) {
+	if !reflect.DeepEqual(a.V, b.V) {
+		t.Errorf("the vertices differ")
+	}
+	if !reflect.DeepEqual(a.E, b.E) {
+		t.Errorf("the edges differ")
+	}
+	if !reflect.DeepEqual(a.Colors, b.Colors) {
+		t.Errorf("the colors differ %v != %v", a.Colors, b.Colors)
+	}
+}
+
+func TestVegParallelMatchesSerial(t *testing.T) {
+	bad := map[int]bool{10: true, 1300: true, 2501: true}
+	input := testVeg(2000, bad)
+	serial, err, serialLines := loadTestVeg(t, input, 1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial.V) != 2000 {
+		t.Fatalf("expected 2000 vertices got %d", len(serial.V))
+	}
+	for _, workers := range []int{2, 8} {
+		G, err, lines := loadTestVeg(t, input, workers, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameGraph(t, serial, G)
+		if !reflect.DeepEqual(serialLines, lines) {
+			t.Errorf("with %d workers the bad lines were %v expected %v", workers, lines, serialLines)
+		}
+	}
+	if !reflect.DeepEqual(serialLines, []int{10, 1300, 2501}) {
+		t.Errorf("the bad lines were %v", serialLines)
+	}
+}
+
+func TestVegParallelAbortsAtSameLine(t *testing.T) {
+	bad := map[int]bool{100: true, 900: true, 1700: true, 3000: true}
+	input := testVeg(2000, bad)
+	serial, serialErr, serialLines := loadTestVeg(t, input, 1, 2)
+	tooMany, ok := serialErr.(*TooManyErrors)
+	if !ok {
+		t.Fatalf("expected TooManyErrors got %v", serialErr)
+	}
+	last := tooMany.Errors[len(tooMany.Errors)-1].(*ParseError).Line
+	if last != 1700 {
+		t.Fatalf("expected to abort at line 1700 not %d", last)
+	}
+	for _, workers := range []int{2, 8} {
+		G, err, lines := loadTestVeg(t, input, workers, 2)
+		tm, ok := err.(*TooManyErrors)
+		if !ok {
+			t.Fatalf("with %d workers expected TooManyErrors got %v", workers, err)
+		}
+		if l := tm.Errors[len(tm.Errors)-1].(*ParseError).Line; l != last {
+			t.Errorf("with %d workers aborted at line %d expected %d", workers, l, last)
+		}
+		if !reflect.DeepEqual(serialLines, lines) {
+			t.Errorf("with %d workers the bad lines were %v expected %v", workers, lines, serialLines)
+		}
+		assertSameGraph(t, serial, G)
+	}
+}
+
+func TestVegCrossTransactionEdge(t *testing.T) {
+	input := []byte(strings.Join([]string{
+		"vertex\t" + `{"id": 1, "label": "a", "graph": "g1"}`,
+		"vertex\t" + `{"id": 2, "label": "b", "graph": "g1"}`,
+		"vertex\t" + `{"id": 3, "label": "a", "graph": "g2"}`,
+		"edge\t" + `{"src": 1, "targ": 2, "label": "x"}`,
+		"edge\t" + `{"src": 2, "targ": 3, "label": "x"}`,
+	}, "\n"))
+	transactions := make(map[int]string)
+	l := NewLoader("graph", nil, transactions)
+	if err := l.Veg("test.veg", bytes.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	G, err := l.Graph()
+	if err == nil {
+		t.Fatal("expected the edge between transactions to be an error")
+	}
+	if errs := l.Errors(); len(errs) != 1 || errs[0].(*ParseError).Line != 5 {
+		t.Errorf("expected an error on line 5 got %v", errs)
+	}
+	if len(G.E) != 1 {
+		t.Errorf("expected 1 edge got %d", len(G.E))
+	}
+	if !reflect.DeepEqual(transactions, map[int]string{0: "g1", 1: "g1", 2: "g2"}) {
+		t.Errorf("the transactions were %v", transactions)
+	}
+}
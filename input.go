@@ -0,0 +1,323 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// magic numbers of the compression formats
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// cmdReader reads the output of a command (such as xz -dc) reporting the
+// command's failure at the end of its output.
+type cmdReader struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr bytes.Buffer
+	done   bool  // the command has been waited for
+	err    error // the error ending the output
+}
+
+func newCmdReader(input io.Reader, name string, args ...string) (*cmdReader, error) {
+	c := &cmdReader{cmd: exec.Command(name, args...)}
+	c.cmd.Stdin = input
+	c.cmd.Stderr = &c.stderr
+	out, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.out = out
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run %v (is it installed?): %v", name, err)
+	}
+	return c, nil
+}
+
+func (c *cmdReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.out.Read(p)
+	if err == io.EOF {
+		c.done = true
+		if werr := c.cmd.Wait(); werr != nil {
+			err = fmt.Errorf("%v: %v: %s", c.cmd.Path, werr, bytes.TrimSpace(c.stderr.Bytes()))
+		}
+	}
+	c.err = err
+	return n, err
+}
+
+func (c *cmdReader) Close() error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	c.out.Close()
+	return c.cmd.Wait()
+}
+
+// decompress wraps reader to decompress it if it starts with the magic
+// number of gzip, bzip2, xz or zstd. xz and zstd are decompressed with the
+// xz and zstd commands.
+func decompress(reader *bufio.Reader) (io.Reader, func(), error) {
+	head, _ := reader.Peek(6)
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		greader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return greader, func() { greader.Close() }, nil
+	case bytes.HasPrefix(head, bzip2Magic):
+		return bzip2.NewReader(reader), func() {}, nil
+	case bytes.HasPrefix(head, xzMagic):
+		c, err := newCmdReader(reader, "xz", "-dc")
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, func() { c.Close() }, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		c, err := newCmdReader(reader, "zstd", "-dc")
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, func() { c.Close() }, nil
+	}
+	return reader, func() {}, nil
+}
+
+// openInput opens the file at input_path ("-" is standard input) and
+// decompresses it.
+func openInput(input_path string) (reader *bufio.Reader, closeall func(), err error) {
+	var file *os.File
+	if input_path == "-" {
+		file = os.Stdin
+	} else {
+		file, err = os.Open(input_path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	dreader, closer, err := decompress(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return bufio.NewReader(dreader), func() {
+		closer()
+		file.Close()
+	}, nil
+}
+
+// isTar is true if reader starts with a (ustar) tar header.
+func isTar(reader *bufio.Reader) bool {
+	head, _ := reader.Peek(263)
+	return len(head) >= 263 && bytes.HasPrefix(head[257:], []byte("ustar"))
+}
+
+// eachTarEntry calls load with each regular file in the tar archive. Like
+// the files of a directory each entry is decompressed.
+func eachTarEntry(name string, reader io.Reader, load func(name string, reader io.Reader) error) error {
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		reader, closer, err := decompress(bufio.NewReader(tr))
+		if err != nil {
+			return fmt.Errorf("%v: %v", path.Join(name, hdr.Name), err)
+		}
+		err = load(path.Join(name, hdr.Name), bufio.NewReader(reader))
+		closer()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Inputs are the input paths given on the command line. Each is a file,
+// a directory, a glob pattern or "-" for standard input.
+type Inputs struct {
+	Paths     []string
+	Recursive bool     // read the subdirectories of the directories
+	Include   []string // if any, the files in directories must match one
+	Exclude   []string // the files and directories to skip
+}
+
+// matchAny is true if one of the glob patterns matches the path rel (of a
+// file in an input directory). Patterns without a / match the file name.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Files is the input files in the order they are read: the paths in the
+// order given, the matches of a glob pattern and the files in a directory
+// sorted by name. A file is only read once and so is a directory (however
+// many symlinks lead to it) so a cycle of symlinks does not loop forever.
+func (in *Inputs) Files() ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	visited := make(map[string]bool) // the real paths of the directories walked
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if visited[resolved] {
+			return nil
+		}
+		visited[resolved] = true
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, info := range entries {
+			name := path.Join(dir, info.Name())
+			r := path.Join(rel, info.Name())
+			if matchAny(in.Exclude, r) {
+				continue
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				if info, err = os.Stat(name); err != nil {
+					return err
+				}
+			}
+			if info.IsDir() {
+				if !in.Recursive {
+					log.Printf("Skipping the directory %v (see --recursive)", name)
+					continue
+				}
+				if err := walk(name, r); err != nil {
+					return err
+				}
+			} else if len(in.Include) == 0 || matchAny(in.Include, r) {
+				add(name)
+			}
+		}
+		return nil
+	}
+	for _, p := range in.Paths {
+		if p == "-" {
+			add(p)
+			continue
+		}
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			var err error
+			matches, err = filepath.Glob(p)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%v did not match any files", p)
+			}
+			sort.Strings(matches)
+		}
+		for _, m := range matches {
+			stat, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !stat.IsDir() {
+				add(m)
+			} else if err := walk(m, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("there are no input files in %v", strings.Join(in.Paths, " "))
+	}
+	return files, nil
+}
+
+// Each calls load with each input: each (decompressed) file or every file
+// in a tar archive.
+func (in *Inputs) Each(load func(name string, reader io.Reader) error) error {
+	files, err := in.Files()
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if err := eachFile(name, load); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eachFile(name string, load func(name string, reader io.Reader) error) error {
+	reader, closer, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	if isTar(reader) {
+		return eachTarEntry(name, reader, load)
+	}
+	return load(name, reader)
+}
@@ -0,0 +1,123 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/timtadh/graple/graph"
+)
+
+const testVeg = "vertex\t{\"id\": 1, \"label\": \"a\"}\nvertex\t{\"id\": 2, \"label\": \"b\"}\nedge\t{\"src\": 1, \"targ\": 2, \"label\": \"x\"}\n"
+
+func TestTarOfGzippedVeg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graple-input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(testVeg))
+	zw.Close()
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	hdr := &tar.Header{Name: "graph.veg.gz", Mode: 0644, Size: int64(gz.Len()), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(gz.Bytes())
+	tw.Close()
+	tarPath := filepath.Join(dir, "graphs.tar")
+	if err := ioutil.WriteFile(tarPath, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := &Inputs{Paths: []string{tarPath}}
+	var names []string
+	err = inputs.Each(func(name string, reader io.Reader) error {
+		names = append(names, name)
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if string(data) != testVeg {
+			t.Errorf("%v was not decompressed: %q", name, data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != filepath.Join(tarPath, "graph.veg.gz") {
+		t.Fatalf("read the entries %v", names)
+	}
+
+	loader := graph.NewLoader("", nil, nil)
+	if err := LoadInput(loader, graph.UnknownFormat, inputs); err != nil {
+		t.Fatal(err)
+	}
+	G, err := loader.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(G.V) != 2 || len(G.E) != 1 {
+		t.Errorf("loaded %d vertices and %d edges expected 2 and 1", len(G.V), len(G.E))
+	}
+}
+
+func TestRecursiveSymlinkCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graple-input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sub, "graph.veg"), []byte(testVeg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(sub, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	inputs := &Inputs{Paths: []string{dir}, Recursive: true}
+	files, err := inputs.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(sub, "graph.veg") {
+		t.Errorf("expected only %v got %v", filepath.Join(sub, "graph.veg"), files)
+	}
+}
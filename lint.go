@@ -0,0 +1,123 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/graple/graph"
+)
+
+func LintUsage() {
+	fmt.Fprintln(os.Stderr, "usage: graple lint [--skip=<check>]* [Options]* <input-path>...")
+	Usage(ErrorCodes["opts"])
+}
+
+// LintMain is the lint subcommand. It checks the veg input for problems
+// without loading it and exits non-zero if it finds any.
+func LintMain(argv []string) {
+	args, optargs, err := getopt.GetOpt(
+		argv,
+		"h",
+		append([]string{"help", "skip="}, LoadLongOpts...),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		LintUsage()
+	}
+	linter := graph.NewLinter()
+	opts := NewLoadOptions()
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			Usage(0)
+		case "--skip":
+			for _, check := range strings.Split(oa.Arg(), ",") {
+				if !validCheck(check) {
+					fmt.Fprintf(os.Stderr, "unknown check %q (expected one of %v)\n", check, strings.Join(graph.LintChecks, ", "))
+					LintUsage()
+				}
+				linter.Skip[check] = true
+			}
+		default:
+			opts.Option(oa)
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+		LintUsage()
+	}
+	if opts.Format != graph.UnknownFormat && opts.Format != graph.VegFormat {
+		fmt.Fprintln(os.Stderr, "lint only checks veg files")
+		LintUsage()
+	}
+	_, linter.Namespace = opts.namespaces()
+	linter.Undirected = opts.Undirected
+	linter.MultiLabels = opts.MultiLabels
+
+	files := 0
+	err = opts.Inputs(args).Each(func(name string, reader io.Reader) error {
+		buf := bufio.NewReader(reader)
+		head, _ := buf.Peek(4096)
+		if opts.Format == graph.UnknownFormat {
+			if f := graph.DetectFormat(name, head); f != graph.VegFormat {
+				log.Printf("Skipping %v: it is %v not veg", name, f)
+				return nil
+			}
+		}
+		files++
+		return linter.Lint(name, buf)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	findings := linter.Findings()
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	fmt.Fprintf(os.Stderr, "%d problems found in %d files\n", len(findings), files)
+	if len(findings) > 0 {
+		os.Exit(ErrorCodes["lint"])
+	}
+}
+
+func validCheck(check string) bool {
+	for _, c := range graph.LintChecks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
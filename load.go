@@ -0,0 +1,375 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+import (
+	"github.com/timtadh/fs2/bptree"
+	"github.com/timtadh/fs2/fmap"
+	"github.com/timtadh/getopt"
+	"github.com/timtadh/goiso"
+)
+
+import (
+	"github.com/timtadh/graple/graph"
+)
+
+// SnapshotName is the name of the snapshot in the cache directory.
+const SnapshotName = "graph.snapshot"
+
+// LoadOptions are the options controlling how the input graph is loaded.
+// They are accepted by mining and by the subcommands which read a graph.
+type LoadOptions struct {
+	MaxErrors       int
+	Namespace       string
+	TransactionAttr string
+	Format          graph.Format
+	VertexLabel     *graph.LabelExpr
+	EdgeLabel       *graph.LabelExpr
+	Rewrite         *graph.Rewriter
+	ExcludeVertices *graph.LabelFilter
+	ExcludeEdges    *graph.LabelFilter
+	Undirected      bool
+	MultiLabels     bool
+	Recursive       bool
+	IncludeFiles    []string
+	ExcludeFiles    []string
+	fingerprint     hash.Hash // of the options given, see InputHash
+}
+
+// LoadLongOpts are the getopt long options handled by LoadOptions.Option.
+var LoadLongOpts = []string{
+	"max-errors=",
+	"namespace-ids=",
+	"transactions=",
+	"input-format=",
+	"vertex-label=",
+	"edge-label=",
+	"label-rules=",
+	"exclude-vertex-labels=",
+	"exclude-edge-labels=",
+	"undirected",
+	"multi-labels",
+	"recursive",
+	"include-files=",
+	"exclude-files=",
+}
+
+func NewLoadOptions() *LoadOptions {
+	return &LoadOptions{
+		Format:      graph.UnknownFormat,
+		VertexLabel: graph.DefaultLabel,
+		EdgeLabel:   graph.DefaultLabel,
+		fingerprint: sha256.New(),
+	}
+}
+
+// Option sets the load option oa. It returns false if oa is not one of
+// the LoadLongOpts.
+func (o *LoadOptions) Option(oa getopt.OptArg) bool {
+	switch oa.Opt() {
+	case "--max-errors":
+		o.MaxErrors = ParseInt(oa.Arg())
+	case "--namespace-ids":
+		o.Namespace = oa.Arg()
+	case "--transactions":
+		o.TransactionAttr = oa.Arg()
+	case "--input-format":
+		o.Format = ParseFormat(oa.Arg())
+	case "--vertex-label":
+		o.VertexLabel = ParseLabelExpr(oa.Arg())
+	case "--edge-label":
+		o.EdgeLabel = ParseLabelExpr(oa.Arg())
+	case "--label-rules":
+		o.Rewrite = LoadRewriter(oa.Arg())
+		o.hashFile(oa.Arg())
+	case "--exclude-vertex-labels":
+		o.ExcludeVertices = AddLabelFilter(o.ExcludeVertices, oa.Arg())
+	case "--exclude-edge-labels":
+		o.ExcludeEdges = AddLabelFilter(o.ExcludeEdges, oa.Arg())
+	case "--undirected":
+		o.Undirected = true
+	case "--multi-labels":
+		o.MultiLabels = true
+	case "--recursive":
+		o.Recursive = true
+	case "--include-files":
+		o.IncludeFiles = append(o.IncludeFiles, AssertGlob(oa.Arg()))
+	case "--exclude-files":
+		o.ExcludeFiles = append(o.ExcludeFiles, AssertGlob(oa.Arg()))
+	default:
+		return false
+	}
+	if strings.HasPrefix(oa.Arg(), "@") {
+		o.hashFile(oa.Arg()[1:])
+	}
+	fmt.Fprintf(o.fingerprint, "%s=%s\n", oa.Opt(), oa.Arg())
+	return true
+}
+
+// hashFile adds the contents of the file an option names to the
+// fingerprint so editing the file invalidates the snapshot.
+func (o *LoadOptions) hashFile(name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(o.fingerprint, f); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Inputs are the input files at the paths selected by the options.
+func (o *LoadOptions) Inputs(paths []string) *Inputs {
+	return &Inputs{
+		Paths:     paths,
+		Recursive: o.Recursive,
+		Include:   o.IncludeFiles,
+		Exclude:   o.ExcludeFiles,
+	}
+}
+
+// InputHash is a hash of the names and contents of the input files (see
+// Inputs) at paths and of the load options. A snapshot is only used by a
+// run with the same input hash.
+func (o *LoadOptions) InputHash(paths []string) ([]byte, error) {
+	h := sha256.New()
+	h.Write(o.fingerprint.Sum(nil))
+	add := func(name string) error {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if stat, err := f.Stat(); err != nil {
+			return err
+		} else if !stat.Mode().IsRegular() {
+			return fmt.Errorf("%v is not a regular file", name)
+		}
+		fmt.Fprintf(h, "%s\n", name)
+		_, err = io.Copy(h, f)
+		return err
+	}
+	files, err := o.Inputs(paths).Files()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// LoadedGraph is a loaded graph and what the miner needs to know about its
+// vertices.
+type LoadedGraph struct {
+	G            *goiso.Graph
+	Transactions map[int]string // nil unless --transactions was given
+	Origins      []int          // nil unless a vertex had several labels
+	EdgeOrigins  []int          // nil unless an edge had several labels
+}
+
+// namespaces is the Loader's SupportAttr and Namespace for the options.
+// --transactions=file makes the FileAttr the transaction and (unless
+// --namespace-ids was given) implies --namespace-ids=file.
+func (o *LoadOptions) namespaces() (transactionAttr, namespace string) {
+	transactionAttr = o.TransactionAttr
+	namespace = o.Namespace
+	if transactionAttr == graph.FileNamespace {
+		transactionAttr = graph.FileAttr
+		if namespace == "" {
+			namespace = graph.FileNamespace
+		}
+	}
+	return transactionAttr, namespace
+}
+
+// Load loads the graph from the inputs at paths putting the vertex and edge
+// attributes in nodeAttrs and edgeAttrs.
+func (o *LoadOptions) Load(paths []string, nodeAttrs, edgeAttrs *bptree.BpTree) *LoadedGraph {
+	var transactions map[int]string
+	transactionAttr, namespace := o.namespaces()
+	if transactionAttr != "" {
+		transactions = make(map[int]string)
+	}
+	loader := graph.NewLoader(transactionAttr, nodeAttrs, transactions)
+	loader.EdgeAttrs = edgeAttrs
+	loader.MaxErrors = o.MaxErrors
+	loader.Namespace = namespace
+	loader.VertexLabel = o.VertexLabel
+	loader.EdgeLabel = o.EdgeLabel
+	loader.Rewrite = o.Rewrite
+	loader.ExcludeVertices = o.ExcludeVertices
+	loader.ExcludeEdges = o.ExcludeEdges
+	loader.Undirected = o.Undirected
+	loader.MultiLabels = o.MultiLabels
+	if err := LoadInput(loader, o.Format, o.Inputs(paths)); err != nil {
+		log.Println("Error loading the graph")
+		log.Fatal(err)
+	}
+	G, err := loader.Graph()
+	if _, bad := err.(graph.ParseErrors); G == nil || (err != nil && !bad) {
+		// the graph could not be built, not just some bad lines
+		log.Println("Error loading the graph")
+		log.Fatal(err)
+	} else if err != nil {
+		for _, e := range loader.Errors() {
+			log.Println(e)
+		}
+		log.Printf("Skipped %d bad lines while loading the graph", len(loader.Errors()))
+	}
+	if exV, exE := loader.Excluded(); exV > 0 || exE > 0 {
+		log.Printf("Excluded %d vertices and %d edges", exV, exE)
+	}
+	if n := loader.DirectedGSpanEdges(); n > 0 {
+		log.Printf("Warning: loaded %d undirected gSpan edges as directed arcs, use --undirected to mine them as gSpan, FSG and Gaston do", n)
+	}
+	return &LoadedGraph{G, transactions, loader.Origins(), loader.EdgeOrigins()}
+}
+
+// LoadCached is Load except that the graph is read from the snapshot in
+// the cache directory when there is one made from the same input.
+func (o *LoadOptions) LoadCached(paths []string, cache string, nodeAttrs, edgeAttrs *bptree.BpTree) *LoadedGraph {
+	snapshot := path.Join(cache, SnapshotName)
+	if _, err := os.Stat(snapshot); err != nil {
+		return o.Load(paths, nodeAttrs, edgeAttrs)
+	}
+	hash, err := o.InputHash(paths)
+	if err != nil {
+		log.Printf("Not using the snapshot %v: %v", snapshot, err)
+		return o.Load(paths, nodeAttrs, edgeAttrs)
+	}
+	var transactions map[int]string
+	if o.TransactionAttr != "" {
+		transactions = make(map[int]string)
+	}
+	G, origins, edgeOrigins, err := graph.ReadSnapshot(snapshot, hash, nodeAttrs, edgeAttrs, transactions)
+	if err == graph.ErrStaleSnapshot {
+		log.Printf("The snapshot %v was made from a different input, ignoring it", snapshot)
+		return o.Load(paths, nodeAttrs, edgeAttrs)
+	} else if err != nil {
+		log.Printf("Not using the snapshot %v: %v", snapshot, err)
+		return o.Load(paths, nodeAttrs, edgeAttrs)
+	}
+	log.Printf("Loaded the graph from the snapshot %v", snapshot)
+	return &LoadedGraph{G, transactions, origins, edgeOrigins}
+}
+
+func SnapshotUsage() {
+	fmt.Fprintln(os.Stderr, "usage: graple snapshot -c <cache> [Load Options]* <input-path>...")
+	Usage(ErrorCodes["opts"])
+}
+
+// SnapshotMain is the snapshot subcommand. It loads the input and saves
+// it as a snapshot in the cache directory.
+func SnapshotMain(argv []string) {
+	args, optargs, err := getopt.GetOpt(
+		argv,
+		"hc:",
+		append([]string{"help", "cache="}, LoadLongOpts...),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		SnapshotUsage()
+	}
+	cache := ""
+	opts := NewLoadOptions()
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			Usage(0)
+		case "-c", "--cache":
+			cache = AssertDir(oa.Arg())
+		default:
+			opts.Option(oa)
+		}
+	}
+	if cache == "" {
+		fmt.Fprintln(os.Stderr, "you must supply a --cache=<dir>")
+		SnapshotUsage()
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+		SnapshotUsage()
+	}
+	hash, err := opts.InputHash(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	nodeBf, err := fmap.Anonymous(fmap.BLOCKSIZE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer nodeBf.Close()
+	nodeAttrs, err := bptree.New(nodeBf, 4, -1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	edgeBf, err := fmap.Anonymous(fmap.BLOCKSIZE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer edgeBf.Close()
+	edgeAttrs, err := bptree.New(edgeBf, 4, -1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	input := opts.Load(args, nodeAttrs, edgeAttrs)
+	G := input.G
+
+	snapshot := path.Join(cache, SnapshotName)
+	tmp := snapshot + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = graph.WriteSnapshot(f, hash, G, input.Transactions, input.Origins, input.EdgeOrigins, nodeAttrs, edgeAttrs)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Fatal(err)
+	}
+	if err := os.Rename(tmp, snapshot); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote the snapshot of %d vertices and %d edges to %v", len(G.V), len(G.E), snapshot)
+}
@@ -24,7 +24,7 @@ package main
  */
 
 import (
-	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	// "encoding/hex"
@@ -33,11 +33,14 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 )
 
 import (
@@ -47,6 +50,7 @@ import (
 	"github.com/timtadh/fs2/bptree"
 	"github.com/timtadh/fs2/fmap"
 	"github.com/timtadh/getopt"
+	"github.com/timtadh/goiso"
 )
 
 import (
@@ -66,6 +70,7 @@ var ErrorCodes map[string]int = map[string]int{
 	"badint":  5,
 	"baddir":  6,
 	"badfile": 7,
+	"lint":    8,
 }
 
 var UsageMessage string = "graple --help"
@@ -78,9 +83,36 @@ Syntax
              --support=<int> --sample-size=<int> \
              [Options]* \
              [Development Options]* \
-             <input-path>
+             <input-path>...
 
-    The input path should be a file (or a gzipped file) in the veg format.
+    Each input path should be a file, a directory of files, a glob
+    pattern (quoted so graple expands it) or a tar archive of files in
+    the veg, gSpan, GraphML or GML format. The files (and archives) may
+    be compressed with gzip, bzip2, xz or zstd (the last two need the xz
+    and zstd commands). The input is only read once so it may also be a
+    pipe. "-" reads standard input. The paths are read in the order
+    given, the files of a directory or a pattern in name order and each
+    file only once. The subdirectories of a directory are only read with
+    --recursive.
+
+    $ graple snapshot -c <path> [Options]* <input-path>...
+
+    Loads the input and saves it as a snapshot in the cache directory
+    (see Snapshots).
+
+    $ graple convert [-o <path>] [Convert Options]* [Options]* <input-path>...
+
+    Loads the input and writes it (or part of it) in another format (see
+    Converting).
+
+    $ graple stats [-s <int>] [--top=<int>] [--json] [Options]* <input-path>...
+
+    Reports on the input to help pick --support and --min-vertices (see
+    Statistics).
+
+    $ graple lint [--skip=<check>]* [Options]* <input-path>...
+
+    Checks veg input for problems without mining it (see Linting).
 
 Example
 
@@ -96,6 +128,96 @@ Options
                                 a subgraph
     --sample-size=<int>         number of samples to collect
     --probabilities             compute the probability matrices
+    --seed=<int>                seed the random walks. Runs with the same
+                                input, options and seed sample the same
+                                patterns. By default a random seed is used.
+                                The seed is written to the seed file in the
+                                output directory before mining starts
+    --max-tries=<int>           give up on sampling once a sample has
+                                taken this many walks (no limit by default)
+    --max-walk-time=<duration>  abandon (and retry) a walk which takes longer
+                                than this, eg. 30s or 5m
+    --time-budget=<duration>    stop sampling after this long, eg. 2h
+                                When a limit (or an interrupt, Ctrl-C) stops
+                                the sampling the patterns found so far are
+                                still written out. sampling.json in the
+                                output directory records the stop_reason
+                                (complete, max-tries, time-budget or
+                                canceled), the number of samples and tries
+                                and the number of walks rejected for each
+                                reason (support, min-vertices,
+                                mixed-partition, walk-time, time-budget,
+                                canceled and stopped)
+    --walkers=<int>             number of random walks to run at once
+                                (default 1). The walkers share what they
+                                have found so far. With more than one the
+                                samples depend on the order the walks
+                                finish in so --seed no longer repeats a run
+    --events=<path>             write what happens while mining to <path>
+                                ("-" for standard output) as JSON lines.
+                                Each has a kind (walk-started, step,
+                                walk-rejected, pattern-accepted,
+                                sampling-stopped, probabilities-started or
+                                probabilities-finished), a time and the
+                                details of the event, eg. the walk, the
+                                pattern, its support and the reason
+    --quiet                     do not log the progress of the mining
+    --max-errors=<int>          number of bad input lines to skip before
+                                giving up (default 0). -1 for no limit
+    --namespace-ids=<ns>        scope vertex ids so they only need to be
+                                unique within a namespace. <ns> is either
+                                "file" (each file of an input directory is
+                                its own namespace) or the name of an
+                                attribute on every vertex and edge line
+    --transactions=<attr>       treat the input as a database of graphs.
+                                <attr> is the vertex attribute naming the
+                                graph (transaction) each vertex is in or
+                                "file" to make each input file a transaction
+                                (implies --namespace-ids=file). The support
+                                is then the number of transactions with an
+                                embedding instead of the minimum image
+                                support. An edge between two transactions
+                                is a bad line. For gSpan inputs use
+                                --transactions=transaction
+    --input-format=<format>     the format of the input: veg, gspan,
+                                graphml or gml. By default it is detected
+                                from the file extension (.veg, .gspan, .fsg,
+                                .gaston, .graphml, .gml) or its contents
+    --vertex-label=<expr>       how to build the vertex labels from their
+                                attributes (default label). Either the name
+                                of an attribute or a template such as
+                                "{kind}:{type}"
+    --edge-label=<expr>         how to build the edge labels (default label)
+    --label-rules=<path>        rewrite the labels as the graph is loaded
+                                with the rules in the file (see Label Rules)
+    --exclude-vertex-labels=<pattern>
+                                leave the vertices with a matching label
+                                (and their edges) out of the graph. May be
+                                given more than once. A /pattern/ is a
+                                regular expression, @path reads a pattern
+                                from each line of the file and anything else
+                                must match the label exactly
+    --exclude-edge-labels=<pattern>
+                                leave the edges with a matching label out of
+                                the graph
+    --undirected                treat the edges as undirected. Each edge is
+                                loaded in both directions, patterns are
+                                grown an undirected edge at a time and the
+                                output has one "--" (dot) or edge (veg) per
+                                undirected edge. --probabilities is not
+                                supported
+    --multi-labels              allow labels to be arrays of alternative
+                                labels. A pattern vertex (or edge) matches a
+                                vertex with any of the labels. Without it an
+                                array label is a bad line
+    --recursive                 read the subdirectories of the input
+                                directories
+    --include-files=<glob>      only read the files in the input directories
+                                with a matching name. A pattern with a /
+                                matches the path below the input directory.
+                                May be given more than once
+    --exclude-files=<glob>      skip the files and directories in the input
+                                directories with a matching name (or path)
 
 Development Options
     --mem-profile=<path>        turn on heap profiling
@@ -119,11 +241,141 @@ veg Grammar
 
     edge -> "edge" "\t" edge_json
 
-    vertex_json -> {"id": int, "label": string, ...}
+    vertex_json -> {"id": id, "label": label, ...}
     // other items are optional
 
-    edge_json -> {"src": int, "targ": int, "label": int, ...}
+    edge_json -> {"src": id, "targ": id, "label": label, ...}
     // other items are  optional
+
+    id -> int | string
+
+    label -> string | number | true | false | null
+           | [label, ...]      // only with --multi-labels
+
+    Ids are compared as text (so 7 and "7" are the same vertex) and may
+    be integers of any size. A vertex keeps its id in its attributes and
+    in embedding.veg (where the vertices are renumbered) as original_id.
+
+    Numbers are canonicalized so 1, 1.0 and 1e0 are the same label. null
+    is the empty label.
+
+    The other items of the vertices and edges are kept (in
+    node-attrs.bptree and edge-attrs.bptree in the output directory) and
+    are written out with each embedding in embedding.dot and embedding.veg.
+
+gSpan File Format
+    The gSpan (also FSG and Gaston) format is a database of graphs. Each
+    graph (transaction) starts with a t line. Vertex ids only need to be
+    unique within their transaction. For example:
+
+    t # 0
+    v 0 C
+    v 1 O
+    e 0 1 2
+
+    The e (and FSG u) edges are undirected in these datasets but are loaded
+    as directed arcs from src to targ unless --undirected is given. Use
+    --undirected to mine the same patterns as gSpan, FSG and Gaston.
+
+GraphML and GML
+    The attributes of the vertices (the data elements in GraphML) are kept
+    as the vertex attributes just like the veg vertex_json and are used
+    to build the labels with --vertex-label (and --edge-label). Unlike
+    veg, a missing attribute is treated as the empty string.
+
+Label Rules
+    The --label-rules file rewrites the labels (after --vertex-label and
+    --edge-label) so several labels can be mined as one. Each line is
+
+    <vertex|edge|label> <re|map> <pattern> => <replacement>
+
+    "label" rules apply to both vertices and edges. "re" rules replace the
+    matches of the regular expression (the replacement may use $1 etc.).
+    "map" rules replace labels exactly equal to the pattern. Rules apply in
+    order. For example:
+
+    # mine calls into the project without regard to the class
+    vertex re ^call cwru\.hacsoc\.expr\..*$ => call <project>
+    edge map ddg => data
+
+    A rewritten vertex keeps its original_label and rewritten_label in its
+    attributes and pattern.veg lists the original_labels of each vertex.
+    The exclusions apply to the rewritten labels. The excluded vertices are
+    kept in node-attrs.bptree (after the vertices of the graph) marked as
+    excluded and listing their excluded_edges. The edges excluded between
+    two vertices which were kept are listed in the excluded_edges of their
+    src vertex.
+
+Snapshots
+    Parsing a large input can take longer than mining it. "graple
+    snapshot" loads the input once (with the same loading options as
+    mining, eg. --vertex-label or --transactions) and saves the graph, its
+    labels and the vertex attributes in <cache>/graph.snapshot. Later runs
+    with the same cache directory memory map the snapshot instead of
+    parsing the input. The snapshot records a hash of the input files and
+    the loading options; when either has changed the snapshot is ignored
+    and the input is parsed as usual. Inputs which are not regular files
+    (eg. /dev/stdin) never use a snapshot.
+
+Converting
+    "graple convert" reads any input graple can mine (using the same
+    loading options) and writes it to -o <path> (default stdout, gzipped
+    if the path ends in .gz). The filters select the vertices to keep and
+    the edges between them are kept. For example to take the largest
+    connected part of one package of a PDG:
+
+    $ graple convert -o expr.veg --where=package=/^cwru\.hacsoc\.expr/ \
+             --component=0 $HOME/data/pdgs.veg.gz
+
+Convert Options
+    -o, --output=<path>         where to write the graph
+    --output-format=<format>    veg, graphml, dot, csv (an edge list) or
+                                gspan. By default it is taken from the
+                                extension of the output path or is veg.
+                                gspan is only standard gSpan (undirected)
+                                with --undirected; otherwise each e line is
+                                an arc from src to targ
+    --keep-vertex-labels=<pattern>
+                                keep only the vertices with a matching
+                                label (the patterns are as for
+                                --exclude-vertex-labels)
+    --where=<attr>=<pattern>    keep only the vertices whose <attr> matches
+                                the pattern. May be given more than once
+    --component=<n>             keep only the n-th largest connected
+                                component (0 is the largest) of what the
+                                other filters kept
+
+Statistics
+    "graple stats" loads the input (using the same loading options as
+    mining) and reports the number of vertices and edges, the most frequent
+    vertex and edge labels, the most frequent (src label, edge label, targ
+    label) triples, the degree distribution and the sizes of the connected
+    components. With -s <support> it also reports how many labels, vertices
+    and edges survive the pruning of infrequent labels done by the miner at
+    that support. --top=<int> (default 20, 0 for all) limits the number of
+    labels and triples shown and --json writes the report as JSON instead of
+    tables.
+
+Linting
+    "graple lint" checks the veg files of the input and prints each problem
+    found as <file>:<line>: <check>: <message>. It exits non-zero if there
+    were any. The ids are scoped as they are when loading (by
+    --namespace-ids or --transactions=file) and --undirected and
+    --multi-labels are taken into account. The checks are:
+
+    syntax                      lines which are not a vertex or edge line
+                                with a JSON object
+    id                          missing or malformed ids
+    duplicate-id                vertex ids defined more than once
+    undefined-vertex            edges to vertices which are not defined
+    edge-before-vertex          edges listed before their vertices
+    label                       missing, array or non-string labels
+    label-whitespace            labels with leading or trailing whitespace
+    self-loop                   edges from a vertex to itself
+    multi-edge                  several edges between the same vertices
+
+    --skip=<check>              do not make the check (may be a comma
+                                separated list and given more than once)
 `
 
 func Usage(code int) {
@@ -137,59 +389,60 @@ func Usage(code int) {
 	os.Exit(code)
 }
 
-func Input(input_path string) (reader io.Reader, closeall func()) {
-	stat, err := os.Stat(input_path)
+// LoadInput feeds each of the inputs (see Inputs.Each) into the loader
+// one at a time so errors can name the file they came from. Unless a
+// format is given it is detected for each file.
+func LoadInput(loader *graph.Loader, format graph.Format, inputs *Inputs) error {
+	return inputs.Each(func(name string, reader io.Reader) error {
+		if format == graph.UnknownFormat {
+			return loader.Load(name, reader)
+		}
+		return loader.LoadFormat(format, name, reader)
+	})
+}
+
+func ParseFormat(str string) graph.Format {
+	f, err := graph.ParseFormat(str)
 	if err != nil {
-		panic(err)
-	}
-	if stat.IsDir() {
-		return InputDir(input_path)
-	} else {
-		return InputFile(input_path)
+		fmt.Fprintln(os.Stderr, err)
+		Usage(ErrorCodes["opts"])
 	}
+	return f
 }
 
-func InputFile(input_path string) (reader io.Reader, closeall func()) {
-	freader, err := os.Open(input_path)
+func ParseLabelExpr(str string) *graph.LabelExpr {
+	e, err := graph.ParseLabelExpr(str)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		Usage(ErrorCodes["opts"])
 	}
-	if strings.HasSuffix(input_path, ".gz") {
-		greader, err := gzip.NewReader(freader)
-		if err != nil {
-			panic(err)
-		}
-		return greader, func() {
-			greader.Close()
-			freader.Close()
-		}
+	return e
+}
+
+func LoadRewriter(rules string) *graph.Rewriter {
+	f, err := os.Open(rules)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		Usage(ErrorCodes["badfile"])
 	}
-	return freader, func() {
-		freader.Close()
+	defer f.Close()
+	r, err := graph.LoadRewriter(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in the label rules %v: %v\n", rules, err)
+		Usage(ErrorCodes["badfile"])
 	}
+	return r
 }
 
-func InputDir(input_dir string) (reader io.Reader, closeall func()) {
-	var readers []io.Reader
-	var closers []func()
-	dir, err := ioutil.ReadDir(input_dir)
-	if err != nil {
-		panic(err)
+func AddLabelFilter(f *graph.LabelFilter, pattern string) *graph.LabelFilter {
+	if f == nil {
+		f = graph.NewLabelFilter()
 	}
-	for _, info := range dir {
-		if info.IsDir() {
-			continue
-		}
-		creader, closer := InputFile(path.Join(input_dir, info.Name()))
-		readers = append(readers, creader)
-		closers = append(closers, closer)
-	}
-	reader = io.MultiReader(readers...)
-	return reader, func() {
-		for _, closer := range closers {
-			closer()
-		}
+	if err := f.Add(pattern); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in the label pattern %v: %v\n", pattern, err)
+		Usage(ErrorCodes["opts"])
 	}
+	return f
 }
 
 func ParseInt(str string) int {
@@ -201,18 +454,73 @@ func ParseInt(str string) int {
 	return i
 }
 
+// AssertGlob checks the glob pattern for a file name is well formed.
+func AssertGlob(pattern string) string {
+	if _, err := path.Match(pattern, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Bad file pattern '%v': %v\n", pattern, err)
+		Usage(ErrorCodes["opts"])
+	}
+	return pattern
+}
+
+func ParseDuration(str string) time.Duration {
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		fmt.Fprintf(os.Stderr, "Error parsing '%v' expected a duration such as 90s or 2h\n", str)
+		Usage(ErrorCodes["badint"])
+	}
+	return d
+}
+
+func ParseSeed(str string) int64 {
+	seed, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing '%v' expected a 64 bit int\n", str)
+		Usage(ErrorCodes["badint"])
+	}
+	return seed
+}
+
+// EventListener is the mine.RandomWalkMiner.OnEvent callback for the
+// main command. Each event is written to w (when not nil) as a line of
+// JSON. Unless quiet the events are also logged, except for the walks
+// starting and their steps which are too numerous. It is nil if there is
+// nothing to do.
+func EventListener(w io.Writer, quiet bool) func(*mine.Event) {
+	if w == nil && quiet {
+		return nil
+	}
+	var lock sync.Mutex
+	var enc *json.Encoder
+	if w != nil {
+		enc = json.NewEncoder(w)
+	}
+	return func(e *mine.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		if enc != nil {
+			if err := enc.Encode(e); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if !quiet && e.Kind != mine.WalkStarted && e.Kind != mine.StepTaken {
+			log.Println(e.Text())
+		}
+	}
+}
+
 func AssertDir(dir string) string {
 	dir = path.Clean(dir)
 	fi, err := os.Stat(dir)
 	if err != nil && os.IsNotExist(err) {
 		err := os.MkdirAll(dir, 0775)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, err.Error())
+			fmt.Fprint(os.Stderr, err.Error())
 			Usage(ErrorCodes["baddir"])
 		}
 		return dir
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprint(os.Stderr, err.Error())
 		Usage(ErrorCodes["baddir"])
 	}
 	if !fi.IsDir() {
@@ -252,7 +560,7 @@ func AssertFile(fname string) string {
 	if err != nil && os.IsNotExist(err) {
 		return fname
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprint(os.Stderr, err.Error())
 		Usage(ErrorCodes["badfile"])
 	} else if fi.IsDir() {
 		fmt.Fprintf(os.Stderr, "Passed in file was a directory, %s", fname)
@@ -262,10 +570,26 @@ func AssertFile(fname string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "snapshot":
+			SnapshotMain(os.Args[2:])
+			return
+		case "convert":
+			ConvertMain(os.Args[2:])
+			return
+		case "stats":
+			StatsMain(os.Args[2:])
+			return
+		case "lint":
+			LintMain(os.Args[2:])
+			return
+		}
+	}
 	args, optargs, err := getopt.GetOpt(
 		os.Args[1:],
         "hs:m:o:c:",
-		[]string{
+		append([]string{
 			"help",
 			"support=",
 			"cache=",
@@ -275,7 +599,14 @@ func main() {
 			"cpu-profile=",
 			"output=",
 			"probabilities",
-		},
+			"seed=",
+			"max-tries=",
+			"max-walk-time=",
+			"time-budget=",
+			"walkers=",
+			"events=",
+			"quiet",
+		}, LoadLongOpts...),
 	)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -291,6 +622,13 @@ func main() {
 	outputDir := ""
 	cache := ""
 	compute_prs := false
+	seed := mine.RandomSeed()
+	maxTries := 0
+	var maxWalkTime, timeBudget time.Duration
+	walkers := 1
+	events := ""
+	quiet := false
+	loadOpts := NewLoadOptions()
 	for _, oa := range optargs {
 		switch oa.Opt() {
 		case "-h", "--help":
@@ -305,12 +643,28 @@ func main() {
 			cache = AssertDir(oa.Arg())
 		case "--probabilities":
 			compute_prs = true
+		case "--seed":
+			seed = ParseSeed(oa.Arg())
+		case "--max-tries":
+			maxTries = ParseInt(oa.Arg())
+		case "--max-walk-time":
+			maxWalkTime = ParseDuration(oa.Arg())
+		case "--time-budget":
+			timeBudget = ParseDuration(oa.Arg())
+		case "--walkers":
+			walkers = ParseInt(oa.Arg())
+		case "--events":
+			events = oa.Arg()
+		case "--quiet":
+			quiet = true
 		case "--sample-size":
 			sampleSize = ParseInt(oa.Arg())
 		case "--mem-profile":
 			memProfile = AssertFile(oa.Arg())
 		case "--cpu-profile":
 			cpuProfile = AssertFile(oa.Arg())
+		default:
+			loadOpts.Option(oa)
 		}
 	}
 
@@ -324,6 +678,11 @@ func main() {
 		Usage(ErrorCodes["opts"])
 	}
 
+	if walkers < 1 {
+		fmt.Fprintf(os.Stderr, "You must supply walkers greater than 0, you gave %v\n", walkers)
+		Usage(ErrorCodes["opts"])
+	}
+
 	if outputDir == "" {
 		fmt.Fprintf(os.Stderr, "You must supply an output file (use -o)\n")
 		Usage(ErrorCodes["opts"])
@@ -334,12 +693,15 @@ func main() {
 		Usage(ErrorCodes["opts"])
 	}
 
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+	if loadOpts.Undirected && compute_prs {
+		fmt.Fprintln(os.Stderr, "--probabilities is not supported with --undirected")
 		Usage(ErrorCodes["opts"])
 	}
 
-	getReader := func() (io.Reader, func()) { return Input(args[0]) }
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+		Usage(ErrorCodes["opts"])
+	}
 
 	if cpuProfile != "" {
 		f, err := os.Create(cpuProfile)
@@ -364,6 +726,18 @@ func main() {
 		defer f.Close()
 	}
 
+	var eventsFile io.Writer
+	if events == "-" {
+		eventsFile = os.Stdout
+	} else if events != "" {
+		f, err := os.Create(events)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventsFile = f
+		defer f.Close()
+	}
+
 	nodePath := path.Join(outputDir, "node-attrs.bptree")
 
 	nodeBf, err := fmap.CreateBlockFile(nodePath)
@@ -376,11 +750,20 @@ func main() {
 		log.Fatal(err)
 	}
 
-	G, err := graph.LoadGraph(getReader, "", nodeAttrs, nil)
+	edgePath := path.Join(outputDir, "edge-attrs.bptree")
+
+	edgeBf, err := fmap.CreateBlockFile(edgePath)
 	if err != nil {
-		log.Println("Error loading the graph")
-		log.Panic(err)
+		log.Fatal(err)
 	}
+	defer edgeBf.Close()
+	edgeAttrs, err := bptree.New(edgeBf, 4, -1)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	input := loadOpts.LoadCached(args, cache, nodeAttrs, edgeAttrs)
+	G := input.G
 	log.Print("Loaded graph, about to start mining")
 
 
@@ -430,16 +813,52 @@ func main() {
 	// 	return store.AnonFs2BpTree(G)
 	// }
 
+	// an interrupt stops the sampling, the patterns found so far are still
+	// written out. A second interrupt kills the process.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			log.Println("Interrupted, stopping the sampling (interrupt again to quit)")
+			signal.Stop(interrupts)
+			cancel()
+		}
+	}()
+
+	// written first so an interrupted or crashed run can be repeated
+	log.Println("Seed", seed)
+	seedPath := path.Join(outputDir, "seed")
+	if f, e := os.Create(seedPath); e != nil {
+		log.Fatal(e)
+	} else {
+		fmt.Fprintln(f, seed)
+		f.Close()
+	}
+
 	m := mine.RandomWalk(
+		ctx,
 		G,
 		support,
 		minVertices,
 		sampleSize,
+		input.Transactions,
+		input.Origins,
+		input.EdgeOrigins,
+		loadOpts.Undirected,
+		seed,
+		maxTries,
+		maxWalkTime,
+		timeBudget,
+		walkers,
+		EventListener(eventsFile, quiet),
 		memProfFile,
 		sgMaker,
 		idxMaker,
 		setsMaker,
 	)
+	defer m.Close()
 	keys := list.NewSorted(10, false)
 	counts := hashtable.NewLinearHash()
 	for label := range m.Report {
@@ -455,6 +874,15 @@ func main() {
 		counts.Put(key, count + 1)
 		keys.Add(key)
 	}
+	if m.StopReason != mine.StoppedComplete {
+		log.Printf("Sampling stopped early (%v) with %d of %d samples", m.StopReason, m.Samples, sampleSize)
+	}
+	samplingPath := path.Join(outputDir, "sampling.json")
+	if data, e := json.MarshalIndent(m.SamplingReport(), "", "  "); e != nil {
+		log.Fatal(e)
+	} else if e := ioutil.WriteFile(samplingPath, append(data, '\n'), 0644); e != nil {
+		log.Fatal(e)
+	}
 	log.Println("Tries", m.Tries)
 	triesPath := path.Join(outputDir, "tries")
 	if f, e := os.Create(triesPath); e != nil {
@@ -472,12 +900,15 @@ func main() {
 			}
 			close(keyCh)
 		}()
-		writeMaximalPatterns(keyCh, m.AllEmbeddings, nodeAttrs, outputDir)
+		writeMaximalPatterns(keyCh, m.AllEmbeddings, nodeAttrs, outputDir, &Renderer{G, loadOpts.Undirected, edgeAttrs})
 	}
 
 	if !compute_prs {
 		log.Println("Done!")
 		return
+	} else if m.StopReason == mine.StoppedCanceled {
+		log.Println("Not computing the probabilities of an interrupted run")
+		return
 	}
 
 	log.Println("Finished writing patterns. Computing probabilities...")
@@ -541,7 +972,73 @@ func main() {
 	log.Println("Done!")
 }
 
-func writeAllPatterns(all store.SubGraphs, nodeAttrs *bptree.BpTree, outputDir string) {
+// Renderer renders the subgraphs written to the output directory.
+type Renderer struct {
+	G          *goiso.Graph
+	Undirected bool
+	EdgeAttrs  *bptree.BpTree // may be nil
+}
+
+// Dot renders sg with graph.Dot when the graph is Undirected or has
+// EdgeAttrs (so every subgraph is rendered the same way, whether or not
+// its edges have attributes) and with goiso otherwise.
+func (r *Renderer) Dot(sg *goiso.SubGraph, attrs, edgeAttrs map[int]map[string]interface{}) string {
+	if r.Undirected || r.EdgeAttrs != nil {
+		return graph.Dot(r.G, sg, attrs, edgeAttrs, r.Undirected)
+	} else if attrs == nil {
+		return sg.String()
+	}
+	return sg.StringWithAttrs(attrs)
+}
+
+func (r *Renderer) VEG(sg *goiso.SubGraph, attrs, edgeAttrs map[int]map[string]interface{}) []byte {
+	if r.Undirected || r.EdgeAttrs != nil || attrs != nil {
+		return graph.VEG(r.G, sg, attrs, edgeAttrs, r.Undirected)
+	}
+	return sg.VEG(attrs)
+}
+
+// SubGraphEdgeAttrs is the attributes of the edges of sg keyed by their index in sg.
+// It is nil if none of the edges have attributes other than their src,
+// targ and label.
+func (r *Renderer) SubGraphEdgeAttrs(sg *goiso.SubGraph) map[int]map[string]interface{} {
+	if r.EdgeAttrs == nil {
+		return nil
+	}
+	attrs := make(map[int]map[string]interface{})
+	extra := false
+	for j, e := range graph.GraphEdges(r.G, sg) {
+		if e == nil {
+			continue
+		}
+		bid := make([]byte, 4)
+		binary.BigEndian.PutUint32(bid, uint32(e.Idx))
+		err := r.EdgeAttrs.DoFind(
+			bid,
+			func(key, value []byte) error {
+				a, err := graph.ParseJson(value)
+				if err != nil {
+					return err
+				}
+				attrs[j] = a
+				return nil
+			})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for k := range attrs[j] {
+			if k != "src" && k != "targ" && k != "label" {
+				extra = true
+			}
+		}
+	}
+	if !extra {
+		return nil
+	}
+	return attrs
+}
+
+func writeAllPatterns(all store.SubGraphs, nodeAttrs *bptree.BpTree, outputDir string, r *Renderer) {
 	alle, err := os.Create(path.Join(outputDir, "all-embeddings.dot"))
 	if err != nil {
 		log.Fatal(err)
@@ -554,20 +1051,20 @@ func writeAllPatterns(all store.SubGraphs, nodeAttrs *bptree.BpTree, outputDir s
 	defer allp.Close()
 	count := 0
 	for key, next := all.Keys()(); next != nil; key, next = next() {
-		writePattern(count, outputDir, alle, allp, nodeAttrs, all, key)
+		writePattern(count, outputDir, alle, allp, nodeAttrs, all, key, r)
 		count++
 	}
 }
 
-func writeMaximalSubGraphs(all store.SubGraphs, nodeAttrs *bptree.BpTree, outputDir string) {
+func writeMaximalSubGraphs(all store.SubGraphs, nodeAttrs *bptree.BpTree, outputDir string, r *Renderer) {
 	keys, err := mine.MaximalSubGraphs(all, nodeAttrs, outputDir) 
 	if err != nil {
 		log.Fatal(err)
 	}
-	writeMaximalPatterns(keys, all, nodeAttrs, outputDir)
+	writeMaximalPatterns(keys, all, nodeAttrs, outputDir, r)
 }
 
-func writeMaximalPatterns(keys <-chan []byte, sgs store.Findable, nodeAttrs *bptree.BpTree, outputDir string) {
+func writeMaximalPatterns(keys <-chan []byte, sgs store.Findable, nodeAttrs *bptree.BpTree, outputDir string, r *Renderer) {
 	maxe, err := os.Create(path.Join(outputDir, "maximal-embeddings.dot"))
 	if err != nil {
 		log.Fatal(err)
@@ -580,7 +1077,7 @@ func writeMaximalPatterns(keys <-chan []byte, sgs store.Findable, nodeAttrs *bpt
 	defer maxp.Close()
 	count := 0
 	for key := range keys {
-		writePattern(count, outputDir, maxe, maxp, nodeAttrs, sgs, key)
+		writePattern(count, outputDir, maxe, maxp, nodeAttrs, sgs, key, r)
 		count++
 	}
 	countPath := path.Join(outputDir, "count")
@@ -592,25 +1089,44 @@ func writeMaximalPatterns(keys <-chan []byte, sgs store.Findable, nodeAttrs *bpt
 	}
 }
 
-func writePattern(count int, outDir string, embeddings, patterns io.Writer, nodeAttrs *bptree.BpTree, all store.Findable, key []byte) {
+func hasOriginals(originals []map[string]bool) bool {
+	for _, o := range originals {
+		if len(o) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSortedEmbeddings is the most embeddings of a pattern writePattern
+// holds in memory to write them in their canonical order (see
+// mine.SortEmbeddings). The embeddings of a pattern with more are written
+// in the order they were stored.
+const maxSortedEmbeddings = 10000
+
+func writePattern(count int, outDir string, embeddings, patterns io.Writer, nodeAttrs *bptree.BpTree, all store.Findable, key []byte, r *Renderer) {
 	patDir := EmptyDir(path.Join(outDir, fmt.Sprintf("%d", count)))
 	patDot := path.Join(patDir, "pattern.dot")
 	patVeg := path.Join(patDir, "pattern.veg")
 	patName := path.Join(patDir, "pattern.name")
 	patCount := path.Join(patDir, "count")
 	instDir := EmptyDir(path.Join(patDir, "instances"))
+	var first *goiso.SubGraph
+	var originals []map[string]bool // the labels each vertex had before rewriting
 	i := 0
-	for _, sg, next := all.Find(key)(); next != nil; _, sg, next = next() {
+	write := func(sg *goiso.SubGraph) {
 		if i == 0 {
+			first = sg
+			originals = make([]map[string]bool, len(sg.V))
 			fmt.Fprintln(patterns, "//", sg.Label())
 			fmt.Fprintln(patterns)
-			fmt.Fprintln(patterns, sg.String())
+			fmt.Fprintln(patterns, r.Dot(sg, nil, nil))
 			fmt.Fprintln(embeddings, "//", sg.Label())
 			fmt.Fprintln(embeddings)
 			if pat, err := os.Create(patDot); err != nil {
 				log.Fatal(err)
 			} else {
-				fmt.Fprintln(pat, sg.String())
+				fmt.Fprintln(pat, r.Dot(sg, nil, nil))
 				pat.Close()
 			}
 			if name, err := os.Create(patName); err != nil {
@@ -622,16 +1138,17 @@ func writePattern(count int, outDir string, embeddings, patterns io.Writer, node
 			if veg, err := os.Create(patVeg); err != nil {
 				log.Fatal(err)
 			} else {
-				veg.Write(sg.VEG(nil))
+				veg.Write(r.VEG(sg, nil, nil))
 				veg.Close()
 			}
 		}
 		curDir := EmptyDir(path.Join(instDir, fmt.Sprintf("%d", i)))
 		emDot := path.Join(curDir, "embedding.dot")
 		emVeg := path.Join(curDir, "embedding.veg")
+		edgeAttrs := r.SubGraphEdgeAttrs(sg)
 		if nodeAttrs != nil {
 			attrs := make(map[int]map[string]interface{})
-			for _, v := range sg.V {
+			for j, v := range sg.V {
 				bid := make([]byte, 4)
 				binary.BigEndian.PutUint32(bid, uint32(v.Id))
 				err := nodeAttrs.DoFind(
@@ -647,37 +1164,82 @@ func writePattern(count int, outDir string, embeddings, patterns io.Writer, node
 				if err != nil {
 					log.Fatal(err)
 				}
+				if orig, has := attrs[v.Id][graph.OriginalLabelAttr]; has && j < len(originals) {
+					if originals[j] == nil {
+						originals[j] = make(map[string]bool)
+					}
+					originals[j][fmt.Sprint(orig)] = true
+				}
 			}
-			fmt.Fprintln(embeddings, sg.StringWithAttrs(attrs))
+			fmt.Fprintln(embeddings, r.Dot(sg, attrs, edgeAttrs))
 			if em, err := os.Create(emDot); err != nil {
 				log.Fatal(err)
 			} else {
-				fmt.Fprintln(em, sg.StringWithAttrs(attrs))
+				fmt.Fprintln(em, r.Dot(sg, attrs, edgeAttrs))
 				em.Close()
 			}
 			if veg, err := os.Create(emVeg); err != nil {
 				log.Fatal(err)
 			} else {
-				veg.Write(sg.VEG(attrs))
+				veg.Write(r.VEG(sg, attrs, edgeAttrs))
 				veg.Close()
 			}
 		} else {
-			fmt.Fprintln(embeddings, sg.String())
+			fmt.Fprintln(embeddings, r.Dot(sg, nil, edgeAttrs))
 			if em, err := os.Create(emDot); err != nil {
 				log.Fatal(err)
 			} else {
-				fmt.Fprintln(em, sg.String())
+				fmt.Fprintln(em, r.Dot(sg, nil, edgeAttrs))
 				em.Close()
 			}
 			if veg, err := os.Create(emVeg); err != nil {
 				log.Fatal(err)
 			} else {
-				veg.Write(sg.VEG(nil))
+				veg.Write(r.VEG(sg, nil, edgeAttrs))
 				veg.Close()
 			}
 		}
 		i++
 	}
+	sorting := true
+	var sgs []*goiso.SubGraph
+	for _, sg, next := all.Find(key)(); next != nil; _, sg, next = next() {
+		if !sorting {
+			write(sg)
+		} else if len(sgs) < maxSortedEmbeddings {
+			sgs = append(sgs, sg)
+		} else {
+			// too many to hold in memory
+			sorting = false
+			for _, s := range sgs {
+				write(s)
+			}
+			sgs = nil
+			write(sg)
+		}
+	}
+	mine.SortEmbeddings(sgs)
+	for _, sg := range sgs {
+		write(sg)
+	}
+	if first != nil && hasOriginals(originals) {
+		// the labels were rewritten so show what they were in the pattern
+		attrs := make(map[int]map[string]interface{})
+		for j, v := range first.V {
+			labels := make([]string, 0, len(originals[j]))
+			for label := range originals[j] {
+				labels = append(labels, label)
+			}
+			sort.Strings(labels)
+			attrs[v.Id] = map[string]interface{}{"original_labels": labels}
+		}
+		if veg, err := os.Create(patVeg); err != nil {
+			log.Fatal(err)
+		} else {
+			veg.Write(r.VEG(first, attrs, nil))
+			veg.Close()
+		}
+	}
 	if c, err := os.Create(patCount); err != nil {
 		log.Fatal(err)
 	} else {
@@ -0,0 +1,74 @@
+package mine
+
+import (
+	"sync"
+)
+
+import (
+	"github.com/timtadh/data-structures/set"
+	"github.com/timtadh/graple/store"
+)
+
+// setsCache is a store.SetsMap which several walkers fill in at once. The
+// set of a key is only computed once: a walker asking for a key another
+// walker is computing waits for its result.
+type setsCache struct {
+	sets    store.SetsMap
+	lock    sync.Mutex
+	pending map[string]*pendingSet // key ==> set being computed
+}
+
+type pendingSet struct {
+	done     chan bool // closed once set is computed
+	set      *set.SortedSet
+	complete bool
+}
+
+func newSetsCache(sets store.SetsMap) *setsCache {
+	return &setsCache{
+		sets:    sets,
+		pending: make(map[string]*pendingSet),
+	}
+}
+
+// get is the set of key. If it is not in the cache it is computed. compute
+// returns false if the set is incomplete (the walk computing it ran out of
+// time or the miner was canceled) in which case it is not cached but is
+// still returned. The walkers waiting on an incomplete set compute it
+// again themselves.
+func (c *setsCache) get(key []byte, compute func() (*set.SortedSet, bool)) *set.SortedSet {
+	c.lock.Lock()
+	for {
+		p, has := c.pending[string(key)]
+		if !has {
+			break
+		}
+		c.lock.Unlock()
+		<-p.done
+		if p.complete {
+			return p.set
+		}
+		c.lock.Lock()
+	}
+	if c.sets.Has(key) {
+		c.lock.Unlock()
+		return c.sets.Get(key)
+	}
+	p := &pendingSet{done: make(chan bool)}
+	c.pending[string(key)] = p
+	c.lock.Unlock()
+	defer func() {
+		// the set is cached (if complete) before it stops being pending
+		c.lock.Lock()
+		delete(c.pending, string(key))
+		c.lock.Unlock()
+		close(p.done)
+	}()
+	s, complete := compute()
+	p.set = s
+	p.complete = complete
+	if complete {
+		c.sets.Put(key, s)
+	}
+	return p.set
+}
@@ -3,6 +3,7 @@ package mine
 import (
 	"bytes"
 	"hash/fnv"
+	"sync"
 )
 
 import (
@@ -13,6 +14,15 @@ import (
 type labelGraph struct {
 	label []byte
 	sg *goiso.SubGraph
+	stored *sync.WaitGroup // may be nil, see Collectors.send
+}
+
+// done tells the sender the graph has been stored (or found to be a
+// duplicate). Every Collector calls it once it is done with lg.
+func (lg *labelGraph) done() {
+	if lg.stored != nil {
+		lg.stored.Done()
+	}
 }
 
 type partition []*goiso.SubGraph
@@ -21,10 +31,13 @@ type partitionIterator func() (part store.Iterator, next partitionIterator)
 type CollectAction func(lg *labelGraph)
 type Collector func(<-chan *labelGraph, chan<- bool)
 
+// Collectors store the embeddings sent to them asynchronously. To Find
+// the embeddings just sent pass send a WaitGroup (which it adds the graph
+// to) and wait on it.
 type Collectors interface {
 	close()
 	delete()
-	send(sg *goiso.SubGraph)
+	send(sg *goiso.SubGraph, stored *sync.WaitGroup)
 	size() int
 	keys() (kit store.BytesIterator)
 	partsCh() <-chan store.Iterator
@@ -66,6 +79,7 @@ func BasicCollector(action CollectAction) Collector {
 	return func(in <-chan *labelGraph, done chan<- bool) {
 		for lg := range in {
 			action(lg)
+			lg.done()
 		}
 		done<-true
 	}
@@ -94,8 +108,11 @@ func (c *SerialCollector) delete() {
 	c.tree.Delete()
 }
 
-func (c *SerialCollector) send(sg *goiso.SubGraph) {
-	c.ch<-&labelGraph{sg.ShortLabel(), sg}
+func (c *SerialCollector) send(sg *goiso.SubGraph, stored *sync.WaitGroup) {
+	if stored != nil {
+		stored.Add(1)
+	}
+	c.ch<-&labelGraph{sg.ShortLabel(), sg, stored}
 }
 
 func (c *SerialCollector) size() int {
@@ -199,10 +216,13 @@ func (c *ParHashCollector) partsCh() <-chan store.Iterator {
 	return out
 }
 
-func (c *ParHashCollector) send(sg *goiso.SubGraph) {
+func (c *ParHashCollector) send(sg *goiso.SubGraph, stored *sync.WaitGroup) {
+	if stored != nil {
+		stored.Add(1)
+	}
 	label := sg.ShortLabel()
 	idx := hash(label) % len(c.chs)
-	c.chs[idx] <- &labelGraph{label, sg}
+	c.chs[idx] <- &labelGraph{label, sg, stored}
 }
 
 func (c *ParHashCollector) makePartitions(sgs store.SubGraphs) (p_it partitionIterator) {
@@ -234,6 +254,8 @@ type ParCollector struct {
 	done chan bool
 }
 
+// MakeParCollector's collector must call done on each labelGraph it
+// receives once it is stored.
 func MakeParCollector(N int, makeStore func()store.SubGraphs, collector func(store.SubGraphs, <-chan *labelGraph, chan<- bool)) Collectors {
 	trees := make([]store.SubGraphs, 0, N)
 	chs := make([]chan<- *labelGraph, 0, N)
@@ -283,9 +305,12 @@ func (c *ParCollector) partsCh() <-chan store.Iterator {
 	return out
 }
 
-func (c *ParCollector) send(sg *goiso.SubGraph) {
+func (c *ParCollector) send(sg *goiso.SubGraph, stored *sync.WaitGroup) {
+	if stored != nil {
+		stored.Add(1)
+	}
 	label := sg.ShortLabel()
-	lg := &labelGraph{label, sg}
+	lg := &labelGraph{label, sg, stored}
 	bkt := hash(label) % len(c.chs)
 	next := bkt
 	for i := 0; i < len(c.chs); i++ {
@@ -0,0 +1,86 @@
+package mine
+
+import (
+	"fmt"
+	"time"
+)
+
+// The kinds of Event.
+const (
+	WalkStarted           = "walk-started"
+	StepTaken             = "step"
+	WalkRejected          = "walk-rejected"
+	PatternAccepted       = "pattern-accepted"
+	SamplingStopped       = "sampling-stopped"
+	ProbabilitiesStarted  = "probabilities-started"
+	ProbabilitiesFinished = "probabilities-finished"
+)
+
+// An Event is something which happened while mining. Kind says what and
+// which of the other fields are set:
+//
+//	walk-started            Walk, Sample
+//	step                    Walk, Pattern, Support, Extensions
+//	walk-rejected           Walk, Reason (one of the Rejected reasons)
+//	pattern-accepted        Walk, Sample, Pattern, Support, Vertices, Edges
+//	sampling-stopped        Reason (one of the Stopped reasons), Sample
+//	probabilities-started   Pattern
+//	probabilities-finished  Pattern, Lattice, Err
+//
+// Walks and samples are numbered from 1.
+type Event struct {
+	Kind       string    `json:"kind"`
+	Time       time.Time `json:"time"`
+	Walk       int       `json:"walk,omitempty"`
+	Sample     int       `json:"sample,omitempty"`
+	Pattern    string    `json:"pattern,omitempty"`
+	Support    int       `json:"support,omitempty"`
+	Extensions int       `json:"extensions,omitempty"`
+	Vertices   int       `json:"vertices,omitempty"`
+	Edges      int       `json:"edges,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Lattice    int       `json:"lattice,omitempty"` // number of subgraphs in the lattice
+	Err        string    `json:"error,omitempty"`
+}
+
+// Text is the event as a log message.
+func (e *Event) Text() string {
+	switch e.Kind {
+	case WalkStarted:
+		return fmt.Sprintf("walk %d started looking for sample %d", e.Walk, e.Sample)
+	case StepTaken:
+		return fmt.Sprintf("walk %d at %v (support %d, %d extensions)", e.Walk, e.Pattern, e.Support, e.Extensions)
+	case WalkRejected:
+		return fmt.Sprintf("walk %d rejected (%v)", e.Walk, e.Reason)
+	case PatternAccepted:
+		return fmt.Sprintf("found mfsg %v (sample %d, support %d)", e.Pattern, e.Sample, e.Support)
+	case SamplingStopped:
+		return fmt.Sprintf("sampling stopped (%v)", e.Reason)
+	case ProbabilitiesStarted:
+		return fmt.Sprintf("computing the probabilities of %v", e.Pattern)
+	case ProbabilitiesFinished:
+		if e.Err != "" {
+			return fmt.Sprintf("computing the probabilities of %v failed: %v", e.Pattern, e.Err)
+		}
+		return fmt.Sprintf("computed the probabilities of %v (lattice size %d)", e.Pattern, e.Lattice)
+	default:
+		return e.Kind
+	}
+}
+
+// event sends e to the OnEvent listener (if there is one).
+func (m *RandomWalkMiner) event(e *Event) {
+	if m.OnEvent == nil {
+		return
+	}
+	e.Time = time.Now()
+	m.OnEvent(e)
+}
+
+// reject records that the walk was rejected for reason.
+func (m *RandomWalkMiner) reject(walk int, reason string) {
+	m.lock.Lock()
+	m.Rejections[reason]++
+	m.lock.Unlock()
+	m.event(&Event{Kind: WalkRejected, Walk: walk, Reason: reason})
+}
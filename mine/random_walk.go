@@ -2,11 +2,15 @@ package mine
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"runtime"
 	"runtime/debug"
+	"sync"
+	"time"
 )
 
 import (
@@ -17,11 +21,57 @@ import (
 )
 
 
+// The reasons a walk is rejected (the keys of RandomWalkMiner.Rejections).
+const (
+	RejectedSupport = "support" // the pattern found did not have enough support
+	RejectedMinVertices = "min-vertices" // the pattern found was too small
+	RejectedMixed = "mixed-partition" // the embeddings were of different subgraphs
+	RejectedWalkTime = "walk-time" // the walk took longer than MaxWalkTime
+	RejectedTimeBudget = "time-budget" // the walk was cut short by the TimeBudget
+	RejectedCanceled = "canceled" // the walk was cut short by the context
+	RejectedStopped = "stopped" // another walker ended the sampling first
+)
+
+// The reasons sampling stops (RandomWalkMiner.StopReason).
+const (
+	StoppedComplete = "complete" // SampleSize samples were collected
+	StoppedMaxTries = "max-tries" // a sample was tried MaxTries times
+	StoppedTimeBudget = "time-budget" // the TimeBudget ran out
+	StoppedCanceled = "canceled" // the context was canceled
+)
+
+// RandomWalkMiner samples maximal frequent subgraphs by random walks. The
+// walks which do not end at a pattern satisfying the Support and
+// MinVertices are retried. MaxTries, MaxWalkTime and TimeBudget (each
+// unlimited if zero) bound the sampling so a hopeless search ends. When a
+// bound is hit sampling stops early: Report is closed with the samples
+// found so far and StopReason says why. Canceling the context given to
+// RandomWalk stops the sampling the same way and stops the goroutines
+// extending the embeddings. A walk which runs past its MaxWalkTime or the
+// TimeBudget is stopped the same way, even in the middle of a step. Close
+// the miner once the embeddings have been written out.
+//
+// Walkers random walks are run at once. They share the embeddings and the
+// caches of the extensions. Walker w draws from its own source of
+// randomness seeded with Seed + w, but which of their walks become the
+// samples depends on the order they finish in so only a single walker
+// samples the same patterns for the same Seed. The walks still running
+// when the sampling stops are rejected as stopped.
 type RandomWalkMiner struct {
 	Graph *goiso.Graph
 	Support int
 	MinVertices int
 	SampleSize int
+	Transactions map[int]string // vertex idx ==> transaction, nil for MNI support
+	Origins []int // vertex idx ==> idx of the vertex it is a copy of, nil if none are copies
+	EdgeOrigins []int // edge idx ==> idx of the first arc of the same input edge, nil if no edge had several labels
+	Undirected bool // edges were loaded as pairs of opposing arcs
+	Seed int64 // of the miner's source of randomness
+	MaxTries int // walks to try for one sample
+	MaxWalkTime time.Duration // of a single walk
+	TimeBudget time.Duration // of all the sampling
+	Walkers int // random walks run at once
+	OnEvent func(*Event) // may be nil, called as the mining progresses (concurrently if there are several Walkers)
 	PLevel int
 	Report chan []byte
 	MakeStore func() store.SubGraphs
@@ -29,17 +79,36 @@ type RandomWalkMiner struct {
 	MakeSetsMap func() store.SetsMap
 	startingPoints *set.SortedSet // source of memory
 	AllEmbeddings Collectors
-	extended store.SetsMap // source of memory
+	extended *setsCache // source of memory
 	                               // types.ByteSlice, set.SortedSet
-	supportedExtensions store.SetsMap // source of memory
+	supportedExtensions *setsCache // source of memory
 	                               // types.ByteSlice, set.SortedSet
+	// How the sampling went. Set before Report is closed.
 	Tries int
+	Samples int
+	Rejections map[string]int // rejection reason ==> number of walks
+	StopReason string
+	Elapsed time.Duration
+	lock sync.Mutex // guards the above and the below while the walkers run
+	tries int // walks since the last sample
+	stopped bool
+	ctx context.Context
 }
 
 
 func RandomWalk(
+	ctx context.Context,
 	G *goiso.Graph,
 	support, minVertices, sampleSize int,
+	transactions map[int]string,
+	origins []int,
+	edgeOrigins []int,
+	undirected bool,
+	seed int64,
+	maxTries int,
+	maxWalkTime, timeBudget time.Duration,
+	walkers int,
+	onEvent func(*Event),
 	memProf io.Writer,
 	makeStore func() store.SubGraphs,
 	makeUnique func() store.UniqueIndex,
@@ -52,17 +121,26 @@ func RandomWalk(
 		Support: support,
 		MinVertices: minVertices,
 		SampleSize: sampleSize,
+		Transactions: transactions,
+		Origins: origins,
+		EdgeOrigins: edgeOrigins,
+		Undirected: undirected,
+		Seed: seed,
+		MaxTries: maxTries,
+		MaxWalkTime: maxWalkTime,
+		TimeBudget: timeBudget,
+		Walkers: walkers,
+		OnEvent: onEvent,
+		ctx: ctx,
 		PLevel: runtime.NumCPU(),
 		Report: make(chan []byte),
 		MakeStore: makeStore,
 		MakeUnique: makeUnique,
 		MakeSetsMap: makeSetsMap,
-		extended: makeSetsMap(),
-		supportedExtensions: makeSetsMap(),
+		extended: newSetsCache(makeSetsMap()),
+		supportedExtensions: newSetsCache(makeSetsMap()),
 	}
-	go func() {
-		m.Tries = m.sample(sampleSize)
-	}()
+	go m.sample(sampleSize)
 	return m
 }
 
@@ -78,16 +156,29 @@ type Sparse struct {
 }
 
 func (m *RandomWalkMiner) PrMatrices(sg *goiso.SubGraph) (vp int, Q, R, u Sparse, err error) {
+	label := sg.Label()
+	m.event(&Event{Kind: ProbabilitiesStarted, Pattern: label})
+	latticeSize := 0
+	defer func() {
+		// runs after the recover below has set err
+		e := &Event{Kind: ProbabilitiesFinished, Pattern: label, Lattice: latticeSize}
+		if err != nil {
+			e.Err = err.Error()
+		}
+		m.event(e)
+	}()
 	defer func() {
 		if e := recover(); e != nil {
 			stack := string(debug.Stack())
 			err = fmt.Errorf("%v\n%v", e, stack)
 		}
 	}()
+	if m.Undirected {
+		return 0, Q, R, u, fmt.Errorf("selection probabilities are not supported for undirected graphs")
+	}
 	lattice := sg.Lattice()
-	log.Printf("lattice size %d %v", len(lattice.V), sg.Label())
+	latticeSize = len(lattice.V)
 	p := m.probabilities(lattice)
-	log.Println("got transistion probabilities", p)
 	vp = m.startingPoints.Size()
 	Q = Sparse{
 		Rows: len(lattice.V)-1,
@@ -128,8 +219,8 @@ func (m *RandomWalkMiner) probabilities(lattice *goiso.Lattice) []int {
 		// This is incorrect, I am doing multiple extensions of the SAME graph
 		// ending up with wierdness. I need to make sure I only extend a graph
 		// ONCE.
-		keys := m.extensions(part) // WRITES
-		count := m.supportedKeys(key, keys).Size() // READS
+		keys := m.extensions(m.ctx, part) // WRITES
+		count := m.supportedKeys(m.ctx, key, keys).Size() // READS
 		if i + 1 == len(lattice.V) {
 			P[i] = -1
 		} else if count == 0 {
@@ -145,63 +236,244 @@ func (m *RandomWalkMiner) probabilities(lattice *goiso.Lattice) []int {
 	return P
 }
 
-func (m *RandomWalkMiner) sample(size int) (tries int) {
+func (m *RandomWalkMiner) sample(size int) {
+	start := time.Now()
+	m.Rejections = make(map[string]int)
+	m.StopReason = StoppedComplete
+	defer func() {
+		m.Elapsed = time.Since(start)
+		m.event(&Event{Kind: SamplingStopped, Reason: m.StopReason, Sample: m.Samples})
+		close(m.Report)
+	}()
+	var budget time.Time // the end of the TimeBudget
+	if m.TimeBudget > 0 {
+		budget = start.Add(m.TimeBudget)
+	}
 	if m.AllEmbeddings == nil {
 		m.AllEmbeddings, m.startingPoints = m.initial()
 	}
-	for i := 0; i < size; i++ {
-		retry: for {
-			tries++
-			part := m.walk()
-			if len(part) < m.Support {
-				log.Println("found mfsg but it did not have enough support")
-				continue retry
-			} else if len(part[0].V) < m.MinVertices {
-				log.Println("found mfsg but it was too small")
-				continue retry
+	walkers := m.Walkers
+	if walkers < 1 {
+		walkers = 1
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < walkers; w++ {
+		wg.Add(1)
+		go func(random *rand.Rand) {
+			defer wg.Done()
+			m.walker(random, size, budget)
+		}(rand.New(rand.NewSource(m.Seed + int64(w))))
+	}
+	wg.Wait()
+}
+
+// walker walks until the sampling stops reporting the patterns it finds.
+func (m *RandomWalkMiner) walker(random *rand.Rand, size int, budget time.Time) {
+	for {
+		walk, sample, ok := m.nextWalk(size, budget)
+		if !ok {
+			return
+		}
+		m.event(&Event{Kind: WalkStarted, Walk: walk, Sample: sample})
+		deadline := budget
+		if m.MaxWalkTime > 0 {
+			if end := time.Now().Add(m.MaxWalkTime); deadline.IsZero() || end.Before(deadline) {
+				deadline = end
 			}
-			label := part[0].ShortLabel()
-			for _, sg := range part {
-				if !bytes.Equal(label, sg.ShortLabel()) {
-					log.Println("different subgraphs in part")
-					continue retry
-				}
+		}
+		ctx, cancel := m.ctx, context.CancelFunc(func() {})
+		if !deadline.IsZero() {
+			ctx, cancel = context.WithDeadline(m.ctx, deadline)
+		}
+		part, finished := m.walk(ctx, random, walk)
+		cancel()
+		if !finished {
+			if m.ctx.Err() != nil {
+				m.reject(walk, RejectedCanceled)
+			} else if !budget.IsZero() && !time.Now().Before(budget) {
+				m.reject(walk, RejectedTimeBudget)
+			} else {
+				m.reject(walk, RejectedWalkTime)
 			}
-			log.Println("found mfsg", part[0].Label())
-			m.Report<-label
-			break retry
+			continue
+		} else if m.support(part) < m.Support {
+			m.reject(walk, RejectedSupport)
+			continue
+		} else if len(part[0].V) < m.MinVertices {
+			m.reject(walk, RejectedMinVertices)
+			continue
+		} else if !m.samePattern(part) {
+			m.reject(walk, RejectedMixed)
+			continue
+		}
+		sample, ok = m.accept(size)
+		if !ok {
+			m.reject(walk, RejectedStopped)
+			continue
+		}
+		m.event(&Event{
+			Kind: PatternAccepted,
+			Walk: walk,
+			Sample: sample,
+			Pattern: part[0].Label(),
+			Support: m.support(part),
+			Vertices: len(part[0].V),
+			Edges: len(part[0].E),
+		})
+		m.Report<-part[0].ShortLabel()
+	}
+}
+
+// nextWalk numbers the walk a walker is about to start and the sample it
+// is looking for. It is false if the sampling has stopped.
+func (m *RandomWalkMiner) nextWalk(size int, budget time.Time) (walk, sample int, ok bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped {
+		return 0, 0, false
+	} else if m.Samples >= size {
+		m.stopped = true
+		return 0, 0, false
+	} else if m.ctx.Err() != nil {
+		m.stop(StoppedCanceled)
+		return 0, 0, false
+	} else if !budget.IsZero() && !time.Now().Before(budget) {
+		m.stop(StoppedTimeBudget)
+		return 0, 0, false
+	} else if m.MaxTries > 0 && m.tries >= m.MaxTries {
+		m.stop(StoppedMaxTries)
+		return 0, 0, false
+	}
+	m.tries++
+	m.Tries++
+	return m.Tries, m.Samples + 1, true
+}
+
+// stop ends the sampling. The lock must be held.
+func (m *RandomWalkMiner) stop(reason string) {
+	m.stopped = true
+	m.StopReason = reason
+}
+
+// accept counts a pattern a walker found as a sample, numbering it. It is
+// false if the sampling stopped while the pattern was being walked to.
+func (m *RandomWalkMiner) accept(size int) (sample int, ok bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped || m.Samples >= size {
+		return 0, false
+	}
+	m.Samples++
+	m.tries = 0
+	if m.Samples >= size {
+		m.stopped = true
+	}
+	return m.Samples, true
+}
+
+// samePattern is false if the embeddings in part are of different
+// subgraphs.
+func (m *RandomWalkMiner) samePattern(part partition) bool {
+	label := part[0].ShortLabel()
+	for _, sg := range part {
+		if !bytes.Equal(label, sg.ShortLabel()) {
+			return false
 		}
 	}
-	close(m.Report)
-	return tries
+	return true
 }
 
-func (m *RandomWalkMiner) walk() partition {
-	node := m.randomInitialPartition()
-	exts := m.extensions(node)
-	// log.Printf("start node (%v) (%d) %v", exts.Size(), len(node), node[0].Label())
-	next := m.randomPartition(node[0].ShortLabel(), exts)
-	for len(next) >= m.Support {
+// walk walks up from a random starting point until it reaches a maximal
+// frequent pattern. It gives up (returning false) if ctx is done before
+// it gets there: the walk's deadline passed or the miner was canceled.
+// The extensions are computed with ctx so a step is cut short as well.
+func (m *RandomWalkMiner) walk(ctx context.Context, random *rand.Rand, walk int) (partition, bool) {
+	node := m.randomInitialPartition(random)
+	exts := m.extensions(ctx, node)
+	m.step(walk, node, exts)
+	next := m.randomPartition(ctx, random, node[0].ShortLabel(), exts)
+	for m.support(next) >= m.Support {
+		if ctx.Err() != nil {
+			return nil, false
+		}
 		node = next
-		exts = m.extensions(node)
-		// log.Printf("cur node (%v) (%d) %v", exts.Size(), len(node), node[0].Label())
-		next = m.randomPartition(node[0].ShortLabel(), exts)
-		if len(next) >= m.Support && len(next[0].E) == len(node[0].E) {
+		exts = m.extensions(ctx, node)
+		m.step(walk, node, exts)
+		next = m.randomPartition(ctx, random, node[0].ShortLabel(), exts)
+		if m.support(next) >= m.Support && len(next[0].E) == len(node[0].E) {
 			break
 		}
 	}
-	return node
+	if ctx.Err() != nil {
+		// the last step was cut short so node may not be maximal
+		return nil, false
+	}
+	return node, true
+}
+
+func (m *RandomWalkMiner) step(walk int, node partition, exts *set.SortedSet) {
+	if m.OnEvent == nil {
+		// the label is expensive
+		return
+	}
+	m.event(&Event{
+		Kind: StepTaken,
+		Walk: walk,
+		Pattern: node[0].Label(),
+		Support: m.support(node),
+		Extensions: exts.Size(),
+	})
+}
+
+// SamplingReport is how the sampling went. It is only complete once
+// Report has been closed.
+type SamplingReport struct {
+	StopReason string `json:"stop_reason"`
+	Samples int `json:"samples"`
+	SampleSize int `json:"sample_size"`
+	Tries int `json:"tries"`
+	Rejections map[string]int `json:"rejections"`
+	Seed int64 `json:"seed"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+func (m *RandomWalkMiner) SamplingReport() *SamplingReport {
+	return &SamplingReport{
+		StopReason: m.StopReason,
+		Samples: m.Samples,
+		SampleSize: m.SampleSize,
+		Tries: m.Tries,
+		Rejections: m.Rejections,
+		Seed: m.Seed,
+		ElapsedSeconds: m.Elapsed.Seconds(),
+	}
+}
+
+// Close stops the collectors (once they have stored the embeddings sent
+// to them) and deletes their stores. The miner can not be used after.
+func (m *RandomWalkMiner) Close() {
+	if m.AllEmbeddings == nil {
+		return
+	}
+	m.AllEmbeddings.close()
+	m.AllEmbeddings.delete()
+	m.AllEmbeddings = nil
 }
 
 func (m *RandomWalkMiner) initial() (Collectors, *set.SortedSet) {
 	groups := m.makeCollectors(m.PLevel)
+	var stored sync.WaitGroup
 	for i := range m.Graph.V {
+		if m.ctx.Err() != nil {
+			break
+		}
 		v := &m.Graph.V[i]
 		if m.Graph.ColorFrequency(v.Color) >= m.Support {
 			sg, _ := m.Graph.VertexSubGraph(v.Idx)
-			groups.send(sg)
+			groups.send(sg, &stored)
 		}
 	}
+	stored.Wait()
 	startingPoints := set.NewSortedSet(10)
 	for key, next := groups.keys()(); next != nil; key, next = next() {
 		startingPoints.Add(types.ByteSlice(key))
@@ -209,7 +481,7 @@ func (m *RandomWalkMiner) initial() (Collectors, *set.SortedSet) {
 	return groups, startingPoints
 }
 
-func (m *RandomWalkMiner) extend(sgs []*goiso.SubGraph, send func(*goiso.SubGraph)) {
+func (m *RandomWalkMiner) extend(ctx context.Context, sgs []*goiso.SubGraph, send func(*goiso.SubGraph)) {
 	type extension struct {
 		sg *goiso.SubGraph
 		e *goiso.Edge
@@ -221,7 +493,24 @@ func (m *RandomWalkMiner) extend(sgs []*goiso.SubGraph, send func(*goiso.SubGrap
 	for i := 0; i < WORKERS; i++ {
 		go func() {
 			for ext := range extend {
+				if ctx.Err() != nil {
+					// drain so the producer is not blocked
+					continue
+				}
+				if !m.distinctEdgeOrigins(ext.sg, ext.e) {
+					// two labels of the same multi-labeled edge
+					continue
+				}
 				nsg, _ := ext.sg.EdgeExtend(ext.e)
+				if m.Undirected {
+					if twin := m.twin(ext.e); twin != nil {
+						nsg, _ = nsg.EdgeExtend(twin)
+					}
+				}
+				if !m.distinctOrigins(nsg) {
+					// two copies of the same multi-labeled vertex
+					continue
+				}
 				extended<-nsg
 			}
 			done <-true
@@ -244,10 +533,16 @@ func (m *RandomWalkMiner) extend(sgs []*goiso.SubGraph, send func(*goiso.SubGrap
 				return
 			}
 			if !sg.HasEdge(goiso.ColoredArc{e.Arc, e.Color}) {
-				extend<-extension{sg, e}
+				select {
+				case extend<-extension{sg, e}:
+				case <-ctx.Done():
+				}
 			}
 		}
 		for i := range sgs[0].V {
+			if ctx.Err() != nil {
+				break
+			}
 			u := &sgs[0].V[i]
 			for _, sg := range sgs {
 				if u.Idx >= len(sg.V) {
@@ -257,6 +552,10 @@ func (m *RandomWalkMiner) extend(sgs []*goiso.SubGraph, send func(*goiso.SubGrap
 				for _, e := range m.Graph.Kids[v.Id] {
 					add(sg, e)
 				}
+				if m.Undirected {
+					// the parents are the twins of the kids
+					continue
+				}
 				for _, e := range m.Graph.Parents[v.Id] {
 					add(sg, e)
 				}
@@ -269,37 +568,116 @@ func (m *RandomWalkMiner) extend(sgs []*goiso.SubGraph, send func(*goiso.SubGrap
 	}
 }
 
-func (m *RandomWalkMiner) extensions(sgs []*goiso.SubGraph) *set.SortedSet {
+// distinctOrigins is false if sg has two copies of the same vertex (see
+// Origins).
+func (m *RandomWalkMiner) distinctOrigins(sg *goiso.SubGraph) bool {
+	if m.Origins == nil {
+		return true
+	}
+	seen := make(map[int]bool, len(sg.V))
+	for _, v := range sg.V {
+		o := m.Origins[v.Id]
+		if seen[o] {
+			return false
+		}
+		seen[o] = true
+	}
+	return true
+}
+
+// distinctEdgeOrigins is false if extending sg with e would use two
+// labels of the same input edge (see EdgeOrigins): an edge of sg between
+// the same vertices with another label must match an arc which is not
+// loaded from e's edge.
+func (m *RandomWalkMiner) distinctEdgeOrigins(sg *goiso.SubGraph, e *goiso.Edge) bool {
+	if m.EdgeOrigins == nil {
+		return true
+	}
+	o := m.EdgeOrigins[e.Idx]
+	for i := range sg.E {
+		se := &sg.E[i]
+		if sg.V[se.Src].Id != e.Src || sg.V[se.Targ].Id != e.Targ || se.Color == e.Color {
+			continue
+		}
+		other := false
+		for _, ge := range m.Graph.Kids[e.Src] {
+			if ge.Targ == e.Targ && ge.Color == se.Color && m.EdgeOrigins[ge.Idx] != o {
+				other = true
+				break
+			}
+		}
+		if !other {
+			return false
+		}
+	}
+	return true
+}
+
+// twin is the arc opposing e in an undirected graph. It is nil for self
+// loops. The loader adds the arcs of each undirected edge together so
+// among parallel edges (with the same label) the n-th arc from src to targ
+// is the twin of the n-th arc from targ to src.
+func (m *RandomWalkMiner) twin(e *goiso.Edge) *goiso.Edge {
+	if e.Src == e.Targ {
+		return nil
+	}
+	n := 0
+	for _, k := range m.Graph.Kids[e.Src] {
+		if k == e {
+			break
+		} else if k.Targ == e.Targ && k.Color == e.Color {
+			n++
+		}
+	}
+	for _, k := range m.Graph.Kids[e.Targ] {
+		if k.Targ == e.Src && k.Color == e.Color {
+			if n == 0 {
+				return k
+			}
+			n--
+		}
+	}
+	return nil
+}
+
+func (m *RandomWalkMiner) extensions(ctx context.Context, sgs []*goiso.SubGraph) *set.SortedSet {
 	if len(sgs) == 0 {
 		return set.NewSortedSet(10)
 	}
 	label := types.ByteSlice(sgs[0].ShortLabel())
-	if m.extended.Has(label) {
-		keys := m.extended.Get(label)
-		return keys
-	}
-	keys := set.NewSortedSet(10)
-	m.extend(sgs, func(sg *goiso.SubGraph) {
-		m.AllEmbeddings.send(sg)
-		keys.Add(types.ByteSlice(sg.ShortLabel()))
+	return m.extended.get(label, func() (*set.SortedSet, bool) {
+		keys := set.NewSortedSet(10)
+		var stored sync.WaitGroup
+		m.extend(ctx, sgs, func(sg *goiso.SubGraph) {
+			m.AllEmbeddings.send(sg, &stored)
+			keys.Add(types.ByteSlice(sg.ShortLabel()))
+		})
+		// the partitions of the keys are only complete once the
+		// collectors have stored every extension
+		stored.Wait()
+		// a canceled (or timed out) extension is incomplete
+		return keys, ctx.Err() == nil
 	})
-	m.extended.Put(label, keys)
-	return keys
 }
 
-func (m *RandomWalkMiner) supportedKeys(from []byte, keys *set.SortedSet) *set.SortedSet {
-	key := types.ByteSlice(from)
-	if m.supportedExtensions.Has(key) {
-		supKeys := m.supportedExtensions.Get(key)
-		return supKeys
-	}
+func (m *RandomWalkMiner) supportedKeys(ctx context.Context, from []byte, keys *set.SortedSet) *set.SortedSet {
+	return m.supportedExtensions.get(from, func() (*set.SortedSet, bool) {
+		return m.supportedKeysOf(ctx, keys), ctx.Err() == nil
+	})
+}
+
+// supportedKeysOf is the keys whose partitions have the support.
+func (m *RandomWalkMiner) supportedKeysOf(ctx context.Context, keys *set.SortedSet) *set.SortedSet {
 	keysCh := make(chan []byte)
 	partKeys := make(chan []byte)
 	done := make(chan bool)
 	for i := 0; i < m.PLevel; i++ {
 		go func() {
 			for key := range keysCh {
-				if len(m.partition(key)) >= m.Support {
+				if ctx.Err() != nil {
+					continue
+				}
+				if m.support(m.partition(key)) >= m.Support {
 					partKeys<-key
 				}
 			}
@@ -307,10 +685,14 @@ func (m *RandomWalkMiner) supportedKeys(from []byte, keys *set.SortedSet) *set.S
 		}()
 	}
 	go func() {
+		defer close(keysCh)
 		for k, next := keys.Items()(); next != nil; k, next = next() {
-			keysCh<-[]byte(k.(types.ByteSlice))
+			select {
+			case keysCh<-[]byte(k.(types.ByteSlice)):
+			case <-ctx.Done():
+				return
+			}
 		}
-		close(keysCh)
 	}()
 	go func() {
 		for i := 0; i < m.PLevel; i++ {
@@ -323,35 +705,62 @@ func (m *RandomWalkMiner) supportedKeys(from []byte, keys *set.SortedSet) *set.S
 	for partKey := range partKeys {
 		supKeys.Add(types.ByteSlice(partKey))
 	}
-	m.supportedExtensions.Put(key, supKeys)
 	return supKeys
 }
 
-func (m *RandomWalkMiner) randomPartition(from []byte, keys *set.SortedSet) partition {
-	supKeys := m.supportedKeys(from, keys)
+func (m *RandomWalkMiner) randomPartition(ctx context.Context, random *rand.Rand, from []byte, keys *set.SortedSet) partition {
+	supKeys := m.supportedKeys(ctx, from, keys)
 	if supKeys.Size() <= 0 {
 		return nil
 	}
-	key, err := supKeys.Random()
-	if err != nil {
-		log.Fatal(err)
-	}
-	return m.partition(key.(types.ByteSlice))
+	return m.partition(randomKey(random, supKeys))
+}
+
+func (m *RandomWalkMiner) randomInitialPartition(random *rand.Rand) partition {
+	return m.partition(randomKey(random, m.startingPoints))
 }
 
-func (m *RandomWalkMiner) randomInitialPartition() partition {
-	key, err := m.startingPoints.Random()
-	if err != nil {
-		log.Fatal(err)
+// randomKey picks one of the keys using the walker's own source of
+// randomness (SortedSet.Random uses the global one) so a walk only
+// depends on the Seed.
+func randomKey(random *rand.Rand, keys *set.SortedSet) []byte {
+	if keys.Size() <= 0 {
+		log.Fatal("there are no keys to choose from")
 	}
-	return m.partition(key.(types.ByteSlice))
+	i := random.Intn(keys.Size())
+	for k, next := keys.Items()(); next != nil; k, next = next() {
+		if i == 0 {
+			return []byte(k.(types.ByteSlice))
+		}
+		i--
+	}
+	panic("unreachable")
 }
 
+// partition is the embeddings of key. The keys come from initial and
+// extensions which wait for the collectors to store the embeddings of
+// the keys they return so the partition is complete.
 func (m *RandomWalkMiner) partition(key []byte) partition {
 	part := make(partition, 0, 10)
 	for _, e, next := m.AllEmbeddings.Find(key)(); next != nil; _, e, next = next() {
 		part = append(part, e)
 	}
-	return MinimumImageSupport(part)
+	// the collectors store the embeddings in the order the extending
+	// goroutines found them
+	SortEmbeddings(part)
+	if m.Transactions != nil {
+		return part
+	}
+	return OriginImageSupport(m.Origins, part)
+}
+
+// support of the partition. Under MNI support the partition has already
+// been reduced to one embedding per supporting vertex so it is just the
+// size. Under transaction support it is the number of transactions.
+func (m *RandomWalkMiner) support(part partition) int {
+	if m.Transactions != nil {
+		return TransactionSupport(m.Transactions, part)
+	}
+	return len(part)
 }
 
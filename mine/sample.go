@@ -5,18 +5,20 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"time"
 )
 
-func init() {
-	if urandom, err := os.Open("/dev/urandom"); err != nil {
-		panic(err)
-	} else {
+// RandomSeed is a seed for a RandomWalkMiner read from /dev/urandom (or
+// the clock if that fails).
+func RandomSeed() int64 {
+	if urandom, err := os.Open("/dev/urandom"); err == nil {
+		defer urandom.Close()
 		seed := make([]byte, 8)
 		if _, err := urandom.Read(seed); err == nil {
-			rand.Seed(int64(binary.BigEndian.Uint64(seed)))
+			return int64(binary.BigEndian.Uint64(seed))
 		}
-		urandom.Close()
 	}
+	return time.Now().UnixNano()
 }
 
 type Samplable interface {
@@ -32,7 +34,7 @@ func srange(size int) []int {
 	return sample
 }
 
-func sample(size, populationSize int) (sample []int) {
+func sample(r *rand.Rand, size, populationSize int) (sample []int) {
 	if size >= populationSize {
 		return srange(populationSize)
 	}
@@ -46,22 +48,22 @@ func sample(size, populationSize int) (sample []int) {
 	}
 	sample = make([]int, 0, size)
 	for i := 0; i < size; i++ {
-		j := rand.Intn(populationSize)
+		j := r.Intn(populationSize)
 		for in(j, sample) {
-			j = rand.Intn(populationSize) 
+			j = r.Intn(populationSize) 
 		}
 		sample = append(sample, j)
 	}
 	return sample
 }
 
-func replacingSample(size, populationSize int) (sample []int) {
+func replacingSample(r *rand.Rand, size, populationSize int) (sample []int) {
 	if size >= populationSize {
 		return srange(populationSize)
 	}
 	sample = make([]int, 0, size)
 	for i := 0; i < size; i++ {
-		j := rand.Intn(populationSize)
+		j := r.Intn(populationSize)
 		sample = append(sample, j)
 	}
 	return sample
@@ -21,6 +21,45 @@ func (s sortableIsoGroup) Len() int { return len(s) }
 func (s sortableIsoGroup) Less(i, j int) bool { return s[i].vertices.Less(s[j].vertices) }
 func (s sortableIsoGroup) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// embeddingOrder orders embeddings (of the same pattern) by the vertices
+// and then the edges they embed into.
+type embeddingOrder []*goiso.SubGraph
+
+func (s embeddingOrder) Len() int { return len(s) }
+func (s embeddingOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s embeddingOrder) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	if len(a.V) != len(b.V) {
+		return len(a.V) < len(b.V)
+	}
+	for k := range a.V {
+		if a.V[k].Id != b.V[k].Id {
+			return a.V[k].Id < b.V[k].Id
+		}
+	}
+	if len(a.E) != len(b.E) {
+		return len(a.E) < len(b.E)
+	}
+	for k := range a.E {
+		x, y := &a.E[k], &b.E[k]
+		if x.Src != y.Src {
+			return x.Src < y.Src
+		} else if x.Targ != y.Targ {
+			return x.Targ < y.Targ
+		} else if x.Color != y.Color {
+			return x.Color < y.Color
+		}
+	}
+	return false
+}
+
+// SortEmbeddings puts the embeddings in a canonical order so the result
+// of mining does not depend on the order the (parallel) collectors found
+// them in.
+func SortEmbeddings(sgs []*goiso.SubGraph) {
+	sort.Sort(embeddingOrder(sgs))
+}
+
 func VertexSet(sg *goiso.SubGraph) *set.SortedSet {
 	s := set.NewSortedSet(len(sg.V))
 	for _, v := range sg.V {
@@ -32,6 +71,12 @@ func VertexSet(sg *goiso.SubGraph) *set.SortedSet {
 }
 
 func VertexSets(sgs partition) []*set.MapSet {
+	return OriginVertexSets(nil, sgs)
+}
+
+// OriginVertexSets is VertexSets with the copies of each vertex (see
+// RandomWalkMiner.Origins) counted as the same vertex. origins may be nil.
+func OriginVertexSets(origins []int, sgs partition) []*set.MapSet {
 	if len(sgs) == 0 {
 		return make([]*set.MapSet, 0)
 	}
@@ -40,6 +85,9 @@ func VertexSets(sgs partition) []*set.MapSet {
 		set := set.NewMapSet(set.NewSortedSet(len(sgs)))
 		for j, sg := range sgs {
 			id := types.Int(sg.V[i].Id)
+			if origins != nil {
+				id = types.Int(origins[sg.V[i].Id])
+			}
 			if !set.Has(id) {
 				set.Put(id, j)
 			}
@@ -50,10 +98,16 @@ func VertexSets(sgs partition) []*set.MapSet {
 }
 
 func MinimumImageSupport(sgs partition) partition {
+	return OriginImageSupport(nil, sgs)
+}
+
+// OriginImageSupport is MinimumImageSupport counting the copies of a
+// vertex as one vertex. origins may be nil.
+func OriginImageSupport(origins []int, sgs partition) partition {
 	if len(sgs) <= 1 {
 		return sgs
 	}
-	sets := VertexSets(sgs)
+	sets := OriginVertexSets(origins, sgs)
 	arg, size := min(srange(len(sets)), func(i int) float64 {
 		return float64(sets[i].Size())
 	})
@@ -65,6 +119,20 @@ func MinimumImageSupport(sgs partition) partition {
 	return supported
 }
 
+// TransactionSupport is the number of distinct transactions with at least
+// one embedding in sgs. The transactions are assumed to be disjoint so an
+// embedding belongs to the transaction of its first vertex.
+func TransactionSupport(transactions map[int]string, sgs partition) int {
+	seen := make(map[string]bool)
+	for _, sg := range sgs {
+		if len(sg.V) == 0 {
+			continue
+		}
+		seen[transactions[sg.V[0].Id]] = true
+	}
+	return len(seen)
+}
+
 func (m *RandomWalkMiner) nonOverlapping(sgs partition) partition {
 	group := make(sortableIsoGroup, 0, len(sgs))
 	for _, sg := range sgs {
@@ -0,0 +1,98 @@
+package main
+
+/* Tim Henderson (tadh@case.edu)
+*
+* Copyright (c) 2015, Tim Henderson, Case Western Reserve University
+* Cleveland, Ohio 44106. All Rights Reserved.
+*
+* This library is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or (at
+* your option) any later version.
+*
+* This library is distributed in the hope that it will be useful, but
+* WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+* General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License
+* along with this library; if not, write to the Free Software
+* Foundation, Inc.,
+*   51 Franklin Street, Fifth Floor,
+*   Boston, MA  02110-1301
+*   USA
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+import (
+	"github.com/timtadh/getopt"
+)
+
+import (
+	"github.com/timtadh/graple/graph"
+)
+
+func StatsUsage() {
+	fmt.Fprintln(os.Stderr, "usage: graple stats [-s <support>] [--top=<n>] [--json] [Options]* <input-path>...")
+	Usage(ErrorCodes["opts"])
+}
+
+// StatsMain is the stats subcommand. It loads the input and reports on
+// its size, labels and structure.
+func StatsMain(argv []string) {
+	args, optargs, err := getopt.GetOpt(
+		argv,
+		"hs:",
+		append([]string{
+			"help",
+			"support=",
+			"top=",
+			"json",
+		}, LoadLongOpts...),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		StatsUsage()
+	}
+	support := 0
+	top := 20
+	asJson := false
+	opts := NewLoadOptions()
+	for _, oa := range optargs {
+		switch oa.Opt() {
+		case "-h", "--help":
+			Usage(0)
+		case "-s", "--support":
+			support = ParseInt(oa.Arg())
+		case "--top":
+			top = ParseInt(oa.Arg())
+		case "--json":
+			asJson = true
+		default:
+			opts.Option(oa)
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Expected a path to the graph file")
+		StatsUsage()
+	}
+
+	input := opts.Load(args, nil, nil)
+	stats := graph.ComputeStats(input.G, support, top, opts.Undirected)
+	if asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(stats)
+	} else {
+		err = stats.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}